@@ -0,0 +1,145 @@
+// Command migrate applies the SQL migrations of a directory with the dbutils/migrate package.
+//
+// Usage:
+//
+//	migrate [flags] up|status|dry-run
+//
+// up applies the pending migrations, status lists all migrations with their state and dry-run lists the migrations
+// up would apply. The database is read from -database or the DATABASE_URL environment variable.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/4ND3R50N/go-tools/dbutils/migrate"
+)
+
+var commands = []string{"up", "status", "dry-run"}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		stop()
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	database := flags.String("database", os.Getenv("DATABASE_URL"), "database URL, defaults to $DATABASE_URL")
+	dir := flags.String("dir", "migrations", "directory of the <version>_<name>.sql files")
+	table := flags.String("table", migrate.DefaultTable, "table of the applied migrations")
+	lockID := flags.String("lock", migrate.DefaultLockID, "id of the advisory lock that serializes up")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: migrate [flags] up|status|dry-run")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected exactly one command")
+	}
+	command := flags.Arg(0)
+	if !slices.Contains(commands, command) {
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+	if *database == "" {
+		return errors.New("no database, set -database or DATABASE_URL")
+	}
+
+	conn, err := pgx.Connect(ctx, *database)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+	migrator, err := migrate.New(
+		conn,
+		os.DirFS(*dir),
+		migrate.WithTable(*table),
+		migrate.WithLockID(*lockID),
+		migrate.WithOnApplied(func(m migrate.Migration, duration time.Duration) {
+			fmt.Fprintf(out, "applied %d %s in %s\n", m.Version, m.Name, duration.Round(time.Millisecond))
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	return execute(ctx, command, migrator, out)
+}
+
+// execute runs one of the commands with migrator and writes its output to out.
+func execute(ctx context.Context, command string, migrator *migrate.Migrator, out io.Writer) error {
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+		return nil
+	case "dry-run":
+		pending, err := migrator.Plan(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+		for _, m := range pending {
+			fmt.Fprintf(out, "would apply %d %s\n", m.Version, m.Name)
+		}
+		return nil
+	case "status":
+		states, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		return printStatus(out, states)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func printStatus(out io.Writer, states []migrate.State) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	drifted := false
+	for _, state := range states {
+		status, appliedAt := "pending", ""
+		if state.Applied {
+			status, appliedAt = "applied", state.AppliedAt.Format(time.RFC3339)
+		}
+		var drift *migrate.DriftError
+		if errors.As(state.Drift, &drift) {
+			status, drifted = "drift: "+drift.Reason, true
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", state.Version, state.Name, status, appliedAt)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if drifted {
+		return migrate.ErrDrift
+	}
+	return nil
+}
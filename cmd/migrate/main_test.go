@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/4ND3R50N/go-tools/dbutils/migrate"
+)
+
+var migrations = fstest.MapFS{
+	"0001_create_users.sql": {Data: []byte("CREATE TABLE users (id int PRIMARY KEY);")},
+	"0002_add_email.sql":    {Data: []byte("ALTER TABLE users ADD COLUMN email text;")},
+}
+
+func TestRunArguments(t *testing.T) {
+	t.Setenv("DATABASE_URL", "")
+	for _, test := range []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{name: "no command", args: nil, err: "expected exactly one command"},
+		{name: "two commands", args: []string{"up", "status"}, err: "expected exactly one command"},
+		{name: "unknown command", args: []string{"down"}, err: `unknown command "down"`},
+		{name: "unknown flag", args: []string{"-force", "up"}, err: "flag provided but not defined: -force"},
+		{name: "no database", args: []string{"up"}, err: "no database, set -database or DATABASE_URL"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			assert.EqualError(t, run(context.Background(), test.args, &out), test.err)
+			assert.Empty(t, out.String())
+		})
+	}
+
+	t.Run("help", func(t *testing.T) {
+		assert.NoError(t, run(context.Background(), []string{"-h"}, &bytes.Buffer{}))
+	})
+}
+
+func TestExecuteDryRun(t *testing.T) {
+	loaded, err := migrate.Load(migrations)
+	require.NoError(t, err)
+	expectHistory := func(mock pgxmock.PgxConnIface, applied ...int64) {
+		mock.
+			ExpectQuery(regexp.QuoteMeta("SELECT to_regclass($1) IS NOT NULL")).
+			WithArgs(`"schema_migrations"`).
+			WillReturnRows(mock.NewRows([]string{"exists"}).AddRow(true))
+		rows := mock.NewRows([]string{"version", "name", "checksum", "applied_at"})
+		for _, m := range loaded {
+			if slices.Contains(applied, m.Version) {
+				rows.AddRow(m.Version, m.Name, m.Checksum, time.Now())
+			}
+		}
+		mock.
+			ExpectQuery(regexp.QuoteMeta(`SELECT version, name, checksum, applied_at FROM "schema_migrations"`)).
+			WillReturnRows(rows)
+	}
+
+	for _, test := range []struct {
+		name    string
+		applied []int64
+		out     string
+	}{
+		{name: "pending migrations", applied: []int64{1}, out: "would apply 2 add_email\n"},
+		{name: "no pending migrations", applied: []int64{1, 2}, out: "no pending migrations\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mock, err := pgxmock.NewConn()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mock.Close(context.Background())
+			expectHistory(mock, test.applied...)
+			migrator, err := migrate.New(mock, migrations)
+			require.NoError(t, err)
+
+			var out bytes.Buffer
+			require.NoError(t, execute(context.Background(), "dry-run", migrator, &out))
+			assert.Equal(t, test.out, out.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+
+	t.Run("drift", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		expectHistory(mock, 2)
+		migrator, err := migrate.New(mock, migrations)
+		require.NoError(t, err)
+
+		var out bytes.Buffer
+		assert.ErrorIs(t, execute(context.Background(), "dry-run", migrator, &out), migrate.ErrDrift)
+		assert.Empty(t, out.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,248 @@
+package dbutils
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PGXCopyInterface is implemented by *pgx.Conn, *pgxpool.Pool and pgx.Tx.
+type PGXCopyInterface interface {
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+type BulkOptions struct {
+	batchSize int
+	include   []string
+	exclude   []string
+}
+
+// WithBatchSize this option copies the rows in batches of the given size instead of all at once.
+func WithBatchSize(batchSize int) func(*BulkOptions) {
+	return func(b *BulkOptions) {
+		b.batchSize = batchSize
+	}
+}
+
+// WithColumns this option only writes the given columns, e.g. to leave the others to their defaults.
+func WithColumns(columns ...string) func(*BulkOptions) {
+	return func(b *BulkOptions) {
+		b.include = append(b.include, columns...)
+	}
+}
+
+// WithoutColumns this option does not write the given columns, e.g. generated ids.
+func WithoutColumns(columns ...string) func(*BulkOptions) {
+	return func(b *BulkOptions) {
+		b.exclude = append(b.exclude, columns...)
+	}
+}
+
+// BulkInsert inserts rows into table with COPY and returns the number of inserted rows. The columns and their values
+// are derived from the fields of T like QueryAll maps them, the column names are the lower case db tags or field
+// names. Batches are copied one after another, so BulkInsert should run inside a Transaction to insert all or nothing.
+// table may be qualified with a schema, e.g. "public.products".
+func BulkInsert[T any](
+	ctx context.Context,
+	db PGXCopyInterface,
+	table string,
+	rows []T,
+	options ...func(*BulkOptions),
+) (int64, error) {
+	opts := &BulkOptions{}
+	for _, o := range options {
+		o(opts)
+	}
+	columns, indexes, err := bulkColumns[T](opts)
+	if err != nil {
+		return 0, err
+	}
+	return copyRows(ctx, db, tableIdentifier(table), columns, indexes, rows, opts.batchSize)
+}
+
+// BulkUpsert inserts rows into table or updates the existing ones that conflict on the keys columns. The rows are
+// copied into a temporary table first, which is merged with INSERT ... ON CONFLICT (keys) DO UPDATE. Columns are
+// derived and table may be qualified like by BulkInsert. BulkUpsert runs in a Transaction on db, or in a savepoint
+// if db is a pgx.Tx. It returns the number of inserted or updated rows.
+// If several rows have the same keys, only the last of them is written, as Postgres can not update a row twice in one
+// statement. Rows with NULL keys never conflict, so all of them are inserted.
+func BulkUpsert[T any](
+	ctx context.Context,
+	db Beginner,
+	table string,
+	keys []string,
+	rows []T,
+	options ...func(*BulkOptions),
+) (int64, error) {
+	opts := &BulkOptions{}
+	for _, o := range options {
+		o(opts)
+	}
+	columns, indexes, err := bulkColumns[T](opts)
+	if err != nil {
+		return 0, err
+	}
+	if len(keys) == 0 {
+		return 0, fmt.Errorf("bulk upsert into %s: no conflict keys", table)
+	}
+	quotedColumns := make([]string, len(columns))
+	for i, column := range columns {
+		quotedColumns[i] = pgx.Identifier{column}.Sanitize()
+	}
+	var quotedKeys, sameKeys, updates []string
+	for _, key := range keys {
+		if !containsFold(columns, key) {
+			return 0, fmt.Errorf("bulk upsert into %s: key %s is not written", table, key)
+		}
+		quotedKey := pgx.Identifier{strings.ToLower(key)}.Sanitize()
+		quotedKeys = append(quotedKeys, quotedKey)
+		sameKeys = append(sameKeys, fmt.Sprintf("l.%[1]s = s.%[1]s", quotedKey))
+	}
+	for i, column := range columns {
+		if !containsFold(keys, column) {
+			updates = append(updates, fmt.Sprintf("%[1]s = excluded.%[1]s", quotedColumns[i]))
+		}
+	}
+	onConflict := "DO NOTHING"
+	if len(updates) > 0 {
+		onConflict = "DO UPDATE SET " + strings.Join(updates, ", ")
+	}
+	target := tableIdentifier(table).Sanitize()
+	// The staging table is dropped at the end of each call, so its name does not have to be unique.
+	staging := pgx.Identifier{"bulk_upsert_staging"}
+	ordinal := pgx.Identifier{"bulk_upsert_ordinal"}.Sanitize()
+	return TransactionResult(ctx, db, func(tx pgx.Tx) (int64, error) {
+		// The staging table only has the written columns, without the constraints and defaults of the target table.
+		if _, err := tx.Exec(ctx, fmt.Sprintf(
+			"CREATE TEMPORARY TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA",
+			staging.Sanitize(),
+			strings.Join(quotedColumns, ", "),
+			target,
+		)); err != nil {
+			return 0, fmt.Errorf("could not create staging table for %s: %w", table, err)
+		}
+		// The ordinal keeps the order of rows, so the last one of the same keys wins.
+		if _, err := tx.Exec(ctx, fmt.Sprintf(
+			"ALTER TABLE %s ADD COLUMN %s bigint GENERATED ALWAYS AS IDENTITY",
+			staging.Sanitize(),
+			ordinal,
+		)); err != nil {
+			return 0, fmt.Errorf("could not create staging table for %s: %w", table, err)
+		}
+		if _, err := copyRows(ctx, tx, staging, columns, indexes, rows, opts.batchSize); err != nil {
+			return 0, err
+		}
+		tag, err := tx.Exec(ctx, fmt.Sprintf(
+			"INSERT INTO %s (%[2]s) SELECT %[2]s FROM %[3]s AS s"+
+				" WHERE NOT EXISTS (SELECT 1 FROM %[3]s AS l WHERE %[4]s AND l.%[5]s > s.%[5]s)"+
+				" ON CONFLICT (%[6]s) %[7]s",
+			target,
+			strings.Join(quotedColumns, ", "),
+			staging.Sanitize(),
+			strings.Join(sameKeys, " AND "),
+			ordinal,
+			strings.Join(quotedKeys, ", "),
+			onConflict,
+		))
+		if err != nil {
+			return 0, fmt.Errorf("could not merge rows into %s: %w", table, err)
+		}
+		// The staging table is dropped right away, so BulkUpsert can run several times in the same transaction.
+		if _, err := tx.Exec(ctx, "DROP TABLE "+staging.Sanitize()); err != nil {
+			return 0, fmt.Errorf("could not drop staging table for %s: %w", table, err)
+		}
+		return tag.RowsAffected(), nil
+	})
+}
+
+// bulkColumns returns the columns of T that are written and the indexes of their fields.
+func bulkColumns[T any](opts *BulkOptions) ([]string, [][]int, error) {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("could not map %s to columns: not a struct", t)
+	}
+	fields := fieldsOf(t)
+	for _, column := range append(slices.Clone(opts.include), opts.exclude...) {
+		if _, ok := fields.byColumn[strings.ToLower(column)]; !ok {
+			return nil, nil, fmt.Errorf("could not map %s to columns: unknown column %s", t, column)
+		}
+	}
+	var (
+		columns []string
+		indexes [][]int
+	)
+	for _, column := range fields.columns {
+		if len(opts.include) > 0 && !containsFold(opts.include, column) || containsFold(opts.exclude, column) {
+			continue
+		}
+		columns = append(columns, column)
+		indexes = append(indexes, fields.byColumn[column].index)
+	}
+	if len(columns) == 0 {
+		return nil, nil, fmt.Errorf("could not map %s to columns: no columns", t)
+	}
+	return columns, indexes, nil
+}
+
+// copyRows copies rows into table in batches of batchSize. A batchSize of 0 copies all rows at once.
+func copyRows[T any](
+	ctx context.Context,
+	db PGXCopyInterface,
+	table pgx.Identifier,
+	columns []string,
+	indexes [][]int,
+	rows []T,
+	batchSize int,
+) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = max(len(rows), 1)
+	}
+	var copied int64
+	for start := 0; start < len(rows); start += batchSize {
+		batch := rows[start:min(start+batchSize, len(rows))]
+		n, err := db.CopyFrom(ctx, table, columns, pgx.CopyFromSlice(len(batch), func(i int) ([]any, error) {
+			v := reflect.ValueOf(batch[i])
+			values := make([]any, len(indexes))
+			for j, index := range indexes {
+				if field, ok := fieldValue(v, index); ok {
+					values[j] = field.Interface()
+				}
+			}
+			return values, nil
+		}))
+		copied += n
+		if err != nil {
+			return copied, fmt.Errorf("could not copy rows into %s: %w", table.Sanitize(), err)
+		}
+	}
+	return copied, nil
+}
+
+// fieldValue behaves like reflect.Value.FieldByIndex, but reports false for fields of nil embedded pointers.
+func fieldValue(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// tableIdentifier splits a table name that is qualified with a schema into its parts.
+func tableIdentifier(table string) pgx.Identifier {
+	return strings.Split(table, ".")
+}
+
+func containsFold(values []string, value string) bool {
+	return slices.ContainsFunc(values, func(v string) bool {
+		return strings.EqualFold(v, value)
+	})
+}
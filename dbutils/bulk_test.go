@@ -0,0 +1,173 @@
+package dbutils_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type product struct {
+	ID    int     `db:"id"`
+	SKU   string  `db:"sku"`
+	Name  string  `db:"name"`
+	Price *int    `db:"price"`
+	Notes string  `db:"-"`
+	Extra *string `db:"extra"`
+}
+
+func TestBulkInsert(t *testing.T) {
+	products := []product{{ID: 1, SKU: "a"}, {ID: 2, SKU: "b"}, {ID: 3, SKU: "c"}}
+
+	t.Run("batches", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		columns := []string{"id", "sku", "name", "price", "extra"}
+		mock.ExpectCopyFrom(pgx.Identifier{"products"}, columns).WillReturnResult(2)
+		mock.ExpectCopyFrom(pgx.Identifier{"products"}, columns).WillReturnResult(1)
+
+		inserted, err := dbutils.BulkInsert(context.Background(), mock, "products", products, dbutils.WithBatchSize(2))
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), inserted)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("include and exclude columns", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.ExpectCopyFrom(pgx.Identifier{"products"}, []string{"sku", "name"}).WillReturnResult(3)
+
+		inserted, err := dbutils.BulkInsert(context.Background(), mock, "products", products,
+			dbutils.WithColumns("sku", "name", "price"), dbutils.WithoutColumns("price"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), inserted)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("schema", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.ExpectCopyFrom(pgx.Identifier{"public", "products"}, []string{"sku"}).WillReturnResult(3)
+
+		inserted, err := dbutils.BulkInsert(context.Background(), mock, "public.products", products,
+			dbutils.WithColumns("sku"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), inserted)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unknown column", func(t *testing.T) {
+		_, err := dbutils.BulkInsert[product](context.Background(), nil, "products", nil, dbutils.WithColumns("notes"))
+		assert.ErrorContains(t, err, "unknown column notes")
+	})
+}
+
+func TestBulkUpsert(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close(context.Background())
+	mock.ExpectBegin()
+	mock.
+		ExpectExec(regexp.QuoteMeta(
+			`CREATE TEMPORARY TABLE "bulk_upsert_staging" ON COMMIT DROP ` +
+				`AS SELECT "sku", "name", "price" FROM "public"."products"`,
+		)).
+		WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+	mock.
+		ExpectExec(regexp.QuoteMeta(
+			`ALTER TABLE "bulk_upsert_staging" ADD COLUMN "bulk_upsert_ordinal" bigint GENERATED ALWAYS AS IDENTITY`,
+		)).
+		WillReturnResult(pgxmock.NewResult("ALTER TABLE", 0))
+	mock.
+		ExpectCopyFrom(pgx.Identifier{"bulk_upsert_staging"}, []string{"sku", "name", "price"}).
+		WillReturnResult(2)
+	mock.
+		ExpectExec(regexp.QuoteMeta(
+			`INSERT INTO "public"."products" ("sku", "name", "price") ` +
+				`SELECT "sku", "name", "price" FROM "bulk_upsert_staging" AS s ` +
+				`WHERE NOT EXISTS (SELECT 1 FROM "bulk_upsert_staging" AS l ` +
+				`WHERE l."sku" = s."sku" AND l."bulk_upsert_ordinal" > s."bulk_upsert_ordinal") ` +
+				`ON CONFLICT ("sku") DO UPDATE SET "name" = excluded."name", "price" = excluded."price"`,
+		)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+	mock.ExpectExec(`DROP TABLE "bulk_upsert_staging"`).WillReturnResult(pgxmock.NewResult("DROP TABLE", 0))
+	mock.ExpectCommit()
+
+	upserted, err := dbutils.BulkUpsert(
+		context.Background(),
+		mock,
+		"public.products",
+		[]string{"sku"},
+		[]product{{SKU: "a", Name: "A"}, {SKU: "b", Name: "B"}},
+		dbutils.WithoutColumns("id", "extra"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), upserted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPGXBulkUpsert(t *testing.T) {
+	ctx := context.Background()
+	_, err := pgxPool.Exec(ctx, `
+		CREATE TABLE products (
+			id serial PRIMARY KEY,
+			sku text NOT NULL UNIQUE,
+			name text NOT NULL,
+			price int,
+			extra text
+		)
+	`)
+	require.NoError(t, err)
+
+	price := 10
+	err = dbutils.Transaction(ctx, pgxPool, func(tx pgx.Tx) error {
+		if _, err := dbutils.BulkInsert(ctx, tx, "products", []product{
+			{SKU: "a", Name: "A"},
+			{SKU: "b", Name: "B"},
+		}, dbutils.WithoutColumns("id"), dbutils.WithBatchSize(1)); err != nil {
+			return err
+		}
+		for range 2 {
+			if _, err := dbutils.BulkUpsert(ctx, tx, "public.products", []string{"sku"}, []product{
+				{SKU: "b", Name: "B2", Price: &price},
+				{SKU: "c", Name: "C"},
+			}, dbutils.WithoutColumns("id")); err != nil {
+				return err
+			}
+		}
+		// Only the last row of the same key is written.
+		upserted, err := dbutils.BulkUpsert(ctx, tx, "products", []string{"sku"}, []product{
+			{SKU: "d", Name: "D1"},
+			{SKU: "a", Name: "A2"},
+			{SKU: "d", Name: "D2"},
+		}, dbutils.WithoutColumns("id"))
+		assert.Equal(t, int64(2), upserted)
+		return err
+	})
+	require.NoError(t, err)
+
+	products, err := dbutils.QueryAll[product](ctx, pgxPool, "SELECT sku, name, price FROM products ORDER BY sku")
+	require.NoError(t, err)
+	assert.Equal(t, []product{
+		{SKU: "a", Name: "A2"},
+		{SKU: "b", Name: "B2", Price: &price},
+		{SKU: "c", Name: "C"},
+		{SKU: "d", Name: "D2"},
+	}, products)
+}
@@ -0,0 +1,87 @@
+package dbutils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrLockTimeout          = errors.New("lock timeout")
+	ErrDeadlock             = errors.New("deadlock detected")
+	ErrSerializationFailure = errors.New("serialization failure")
+	ErrUniqueViolation      = errors.New("unique violation")
+	ErrForeignKeyViolation  = errors.New("foreign key violation")
+	ErrCheckViolation       = errors.New("check violation")
+	ErrNotNullViolation     = errors.New("not null violation")
+
+	// ErrQueryCanceled is SQLSTATE 57014. Postgres returns it for statements that hit the statement timeout, but also
+	// for statements cancelled with pg_cancel_backend or by a cancel request of the client, e.g. on context
+	// cancellation. The SQLSTATE does not tell them apart.
+	ErrQueryCanceled = errors.New("query canceled")
+	// ErrStatementTimeout is returned by Transaction instead of ErrQueryCanceled, if the transaction set a statement
+	// timeout and its context was not cancelled. It matches ErrQueryCanceled as well.
+	ErrStatementTimeout = fmt.Errorf("statement timeout: %w", ErrQueryCanceled)
+)
+
+// pgErrorCodes maps SQLSTATE codes to the errors they are classified as.
+var pgErrorCodes = map[string]error{
+	"55P03": ErrLockTimeout,
+	"57014": ErrQueryCanceled,
+	"40P01": ErrDeadlock,
+	"40001": ErrSerializationFailure,
+	"23505": ErrUniqueViolation,
+	"23503": ErrForeignKeyViolation,
+	"23514": ErrCheckViolation,
+	"23502": ErrNotNullViolation,
+}
+
+// DBError is a classified Postgres error. It matches its Kind and the original error with errors.Is.
+type DBError struct {
+	Kind  error
+	Err   error
+	PgErr *pgconn.PgError
+}
+
+func (e *DBError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DBError) Unwrap() []error {
+	return []error{e.Err, e.Kind}
+}
+
+// ConstraintName returns the name of the violated constraint, if any.
+func (e *DBError) ConstraintName() string {
+	return e.PgErr.ConstraintName
+}
+
+// ColumnName returns the name of the affected column, if any.
+func (e *DBError) ColumnName() string {
+	return e.PgErr.ColumnName
+}
+
+// TableName returns the name of the affected table, if any.
+func (e *DBError) TableName() string {
+	return e.PgErr.TableName
+}
+
+// ClassifyError wraps err into a DBError if it contains a *pgconn.PgError with a known SQLSTATE code. Otherwise, err
+// is returned unchanged.
+// Example: errors.Is(ClassifyError(err), ErrUniqueViolation)
+func ClassifyError(err error) error {
+	var dbErr *DBError
+	if err == nil || errors.As(err, &dbErr) {
+		return err
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	kind, ok := pgErrorCodes[pgErr.Code]
+	if !ok {
+		return err
+	}
+	return &DBError{Kind: kind, Err: err, PgErr: pgErr}
+}
@@ -0,0 +1,155 @@
+package dbutils_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyError(t *testing.T) {
+	type TestCase struct {
+		name         string
+		code         string
+		expectedKind error
+	}
+	testCases := []TestCase{
+		{name: "lock timeout", code: "55P03", expectedKind: dbutils.ErrLockTimeout},
+		{name: "query canceled", code: "57014", expectedKind: dbutils.ErrQueryCanceled},
+		{name: "deadlock", code: "40P01", expectedKind: dbutils.ErrDeadlock},
+		{name: "serialization failure", code: "40001", expectedKind: dbutils.ErrSerializationFailure},
+		{name: "unique violation", code: "23505", expectedKind: dbutils.ErrUniqueViolation},
+		{name: "foreign key violation", code: "23503", expectedKind: dbutils.ErrForeignKeyViolation},
+		{name: "check violation", code: "23514", expectedKind: dbutils.ErrCheckViolation},
+		{name: "not null violation", code: "23502", expectedKind: dbutils.ErrNotNullViolation},
+	}
+
+	for _, tt := range testCases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			pgErr := &pgconn.PgError{Severity: "FEHLER", Code: tt.code, Message: "lokalisierte Meldung"}
+			err := dbutils.ClassifyError(fmt.Errorf("wrapped: %w", pgErr))
+			assert.ErrorIs(t, err, tt.expectedKind)
+			assert.ErrorIs(t, err, pgErr)
+			assert.Equal(t, "wrapped: FEHLER: lokalisierte Meldung (SQLSTATE "+tt.code+")", err.Error())
+		})
+	}
+
+	t.Run("keep unknown errors", func(t *testing.T) {
+		expErr := errors.New("test")
+		assert.Equal(t, expErr, dbutils.ClassifyError(expErr))
+		pgErr := &pgconn.PgError{Code: "42P01"}
+		assert.Equal(t, pgErr, dbutils.ClassifyError(pgErr))
+		assert.NoError(t, dbutils.ClassifyError(nil))
+	})
+
+	t.Run("constraint and column names", func(t *testing.T) {
+		err := dbutils.ClassifyError(&pgconn.PgError{
+			Code:           "23505",
+			TableName:      "users",
+			ColumnName:     "email",
+			ConstraintName: "users_email_key",
+		})
+		var dbErr *dbutils.DBError
+		require.ErrorAs(t, err, &dbErr)
+		assert.Equal(t, "users", dbErr.TableName())
+		assert.Equal(t, "email", dbErr.ColumnName())
+		assert.Equal(t, "users_email_key", dbErr.ConstraintName())
+	})
+
+	t.Run("classified transaction errors", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO test").WithArgs(nil, 1).WillReturnError(&pgconn.PgError{Code: "23502", ColumnName: "a"})
+		mock.ExpectRollback()
+
+		err = dbutils.Transaction(context.Background(), mock, func(tx pgx.Tx) error {
+			_, err := tx.Exec(context.Background(), "INSERT INTO test (A, B) VALUES ($1, $2);", nil, 1)
+			return err
+		})
+		assert.ErrorIs(t, err, dbutils.ErrNotNullViolation)
+		var dbErr *dbutils.DBError
+		require.ErrorAs(t, err, &dbErr)
+		assert.Equal(t, "a", dbErr.ColumnName())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("cancelled query", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.
+			ExpectExec("SELECT pg_sleep").
+			WillReturnError(&pgconn.PgError{Code: "57014", Message: "canceling statement due to user request"})
+		mock.ExpectRollback()
+
+		err = dbutils.Transaction(context.Background(), mock, func(tx pgx.Tx) error {
+			_, err := tx.Exec(context.Background(), "SELECT pg_sleep(10)")
+			return err
+		})
+		assert.ErrorIs(t, err, dbutils.ErrQueryCanceled)
+		// Without a statement timeout, it can not have been one.
+		assert.NotErrorIs(t, err, dbutils.ErrStatementTimeout)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("lock timeout while acquiring locks", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.
+			ExpectExec("SELECT pg_advisory_xact_lock(?)").
+			WithArgs(int64(-4578387130389545126)).
+			WillReturnError(&pgconn.PgError{Code: "55P03"})
+		mock.ExpectRollback()
+
+		err = dbutils.Transaction(context.Background(), mock, func(_ pgx.Tx) error {
+			return nil
+		}, dbutils.WithAdvisoryLock("test1"))
+		assert.Equal(t, dbutils.ErrCouldNotAcquireLock, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPGXQueryCanceled(t *testing.T) {
+	ctx := context.Background()
+	conn, err := pgxPool.Acquire(ctx)
+	require.NoError(t, err)
+	defer conn.Release()
+	pid := conn.Conn().PgConn().PID()
+
+	result := make(chan error)
+	go func() {
+		_, err := conn.Exec(ctx, "SELECT pg_sleep(10)")
+		result <- dbutils.ClassifyError(err)
+	}()
+	// Cancel the query like an operator would, once it is running.
+	require.Eventually(t, func() bool {
+		var cancelled bool
+		err := pgxPool.QueryRow(ctx, `
+			SELECT pg_cancel_backend(pid) FROM pg_stat_activity WHERE pid = $1 AND state = 'active'
+		`, pid).Scan(&cancelled)
+		return err == nil && cancelled
+	}, 5*time.Second, 10*time.Millisecond)
+	err = <-result
+	assert.ErrorIs(t, err, dbutils.ErrQueryCanceled)
+	assert.NotErrorIs(t, err, dbutils.ErrStatementTimeout)
+}
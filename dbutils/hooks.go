@@ -0,0 +1,96 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrHooksNotSupported = errors.New("transaction does not support hooks")
+)
+
+// HookError is returned by Transaction if OnCommit or OnRollback callbacks failed. Committed reports whether the
+// transaction was committed nevertheless.
+type HookError struct {
+	Committed bool
+	Err       error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("transaction hooks failed: %s", e.Err)
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// hookTx is the pgx.Tx that Transaction passes to do. It collects the callbacks registered with OnCommit and
+// OnRollback.
+type hookTx struct {
+	pgx.Tx
+	parent *hookTx
+	// detached is set on savepoints of transactions that were not opened by Transaction. Nobody could tell when they
+	// end, so they do not support hooks.
+	detached   bool
+	onCommit   []func(ctx context.Context) error
+	onRollback []func(ctx context.Context) error
+}
+
+// OnCommit registers fn to run after the transaction of tx was committed. tx has to be the one Transaction passed to
+// do, otherwise ErrHooksNotSupported is returned. Callbacks of a savepoint run after the outermost transaction was
+// committed. Callbacks of attempts that are retried are discarded.
+// If Transaction was called with a pgx.Tx it did not open itself, e.g. from pgx.BeginFunc, do runs in a savepoint of a
+// transaction whose end is unknown, so ErrHooksNotSupported is returned as well.
+func OnCommit(tx pgx.Tx, fn func(ctx context.Context) error) error {
+	h, ok := tx.(*hookTx)
+	if !ok || h.detached {
+		return ErrHooksNotSupported
+	}
+	h.onCommit = append(h.onCommit, fn)
+	return nil
+}
+
+// OnRollback registers fn to run after the transaction of tx was rolled back, also if do panicked, before the panic is
+// passed on. Like OnCommit, tx has to be the one Transaction passed to do.
+func OnRollback(tx pgx.Tx, fn func(ctx context.Context) error) error {
+	h, ok := tx.(*hookTx)
+	if !ok || h.detached {
+		return ErrHooksNotSupported
+	}
+	h.onRollback = append(h.onRollback, fn)
+	return nil
+}
+
+// run runs the callbacks in order of registration, depending on err, the result of the transaction. The callbacks of a
+// released savepoint are handed over to the parent transaction instead.
+func (h *hookTx) run(ctx context.Context, err error) error {
+	if h == nil {
+		return err
+	}
+	if err == nil && h.parent != nil {
+		h.parent.onCommit = append(h.parent.onCommit, h.onCommit...)
+		h.parent.onRollback = append(h.parent.onRollback, h.onRollback...)
+		return nil
+	}
+	callbacks := h.onCommit
+	if err != nil {
+		callbacks = h.onRollback
+	}
+	var errs []error
+	for _, fn := range callbacks {
+		if fnErr := fn(ctx); fnErr != nil {
+			errs = append(errs, fnErr)
+		}
+	}
+	if len(errs) == 0 {
+		return err
+	}
+	hookErr := &HookError{Committed: err == nil, Err: errors.Join(errs...)}
+	if err == nil {
+		return hookErr
+	}
+	return errors.Join(err, hookErr)
+}
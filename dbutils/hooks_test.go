@@ -0,0 +1,243 @@
+package dbutils_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHooks(t *testing.T) {
+	ctx := context.Background()
+	record := func(calls *[]string, call string, err error) func(context.Context) error {
+		return func(context.Context) error {
+			*calls = append(*calls, call)
+			return err
+		}
+	}
+
+	t.Run("run commit hooks in order", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		var calls []string
+		require.NoError(t, dbutils.Transaction(ctx, mock, func(tx pgx.Tx) error {
+			require.NoError(t, dbutils.OnCommit(tx, record(&calls, "commit 1", nil)))
+			require.NoError(t, dbutils.OnRollback(tx, record(&calls, "rollback", nil)))
+			require.NoError(t, dbutils.OnCommit(tx, record(&calls, "commit 2", nil)))
+			assert.Empty(t, calls)
+			return nil
+		}))
+		assert.Equal(t, []string{"commit 1", "commit 2"}, calls)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("run rollback hooks", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		var calls []string
+		expErr := errors.New("test")
+		err = dbutils.Transaction(ctx, mock, func(tx pgx.Tx) error {
+			require.NoError(t, dbutils.OnCommit(tx, record(&calls, "commit", nil)))
+			require.NoError(t, dbutils.OnRollback(tx, record(&calls, "rollback", nil)))
+			return expErr
+		})
+		assert.ErrorIs(t, err, expErr)
+		assert.Equal(t, []string{"rollback"}, calls)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("run rollback hooks on panic", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		var calls []string
+		assert.PanicsWithValue(t, "boom", func() {
+			_ = dbutils.Transaction(ctx, mock, func(tx pgx.Tx) error {
+				require.NoError(t, dbutils.OnCommit(tx, record(&calls, "commit", nil)))
+				require.NoError(t, dbutils.OnRollback(tx, record(&calls, "rollback", nil)))
+				panic("boom")
+			})
+		})
+		assert.Equal(t, []string{"rollback"}, calls)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("collect hook errors", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		var calls []string
+		hookErr1, hookErr2 := errors.New("hook 1"), errors.New("hook 2")
+		err = dbutils.Transaction(ctx, mock, func(tx pgx.Tx) error {
+			require.NoError(t, dbutils.OnCommit(tx, record(&calls, "commit 1", hookErr1)))
+			require.NoError(t, dbutils.OnCommit(tx, record(&calls, "commit 2", hookErr2)))
+			return nil
+		})
+		var hookErr *dbutils.HookError
+		require.ErrorAs(t, err, &hookErr)
+		assert.True(t, hookErr.Committed)
+		assert.ErrorIs(t, err, hookErr1)
+		assert.ErrorIs(t, err, hookErr2)
+		assert.Equal(t, []string{"commit 1", "commit 2"}, calls)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("discard hooks of retried attempts", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectCommit().WillReturnError(&pgconn.PgError{Code: "40001"})
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		var calls []string
+		attempts := 0
+		require.NoError(t, dbutils.Transaction(ctx, mock, func(tx pgx.Tx) error {
+			attempts++
+			if attempts == 1 {
+				require.NoError(t, dbutils.OnCommit(tx, record(&calls, "commit 1", nil)))
+				require.NoError(t, dbutils.OnRollback(tx, record(&calls, "rollback 1", nil)))
+				return nil
+			}
+			return dbutils.OnCommit(tx, record(&calls, "commit 2", nil))
+		}, dbutils.WithRetry(2, dbutils.WithBackoff(time.Millisecond, time.Millisecond))))
+		assert.Equal(t, []string{"commit 2"}, calls)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("savepoint hooks", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+		mock.ExpectCommit()
+
+		var calls []string
+		expErr := errors.New("test")
+		require.NoError(t, dbutils.Transaction(ctx, mock, func(tx pgx.Tx) error {
+			err := dbutils.Transaction(ctx, tx, func(tx pgx.Tx) error {
+				require.NoError(t, dbutils.OnCommit(tx, record(&calls, "rolled back savepoint commit", nil)))
+				require.NoError(t, dbutils.OnRollback(tx, record(&calls, "rolled back savepoint rollback", nil)))
+				return expErr
+			})
+			assert.ErrorIs(t, err, expErr)
+			require.NoError(t, dbutils.Transaction(ctx, tx, func(tx pgx.Tx) error {
+				return dbutils.OnCommit(tx, record(&calls, "released savepoint commit", nil))
+			}))
+			// Hooks of the released savepoint wait for the outer transaction.
+			assert.Equal(t, []string{"rolled back savepoint rollback"}, calls)
+			return dbutils.OnCommit(tx, record(&calls, "commit", nil))
+		}))
+		assert.Equal(t, []string{"rolled back savepoint rollback", "released savepoint commit", "commit"}, calls)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("keep result if commit hooks failed", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		var calls []string
+		expErr := errors.New("hook")
+		id, err := dbutils.TransactionResult(ctx, mock, func(tx pgx.Tx) (int, error) {
+			return 42, dbutils.OnCommit(tx, record(&calls, "commit", expErr))
+		})
+		var hookErr *dbutils.HookError
+		require.ErrorAs(t, err, &hookErr)
+		assert.True(t, hookErr.Committed)
+		assert.Equal(t, 42, id)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("savepoints of foreign transactions", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectBegin()
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+		mock.ExpectCommit()
+		mock.ExpectRollback()
+
+		tx, err := mock.Begin(ctx)
+		require.NoError(t, err)
+		// The mock transaction is able to begin top level transactions, a real pgx.Tx is not.
+		outer := struct{ pgx.Tx }{tx}
+		// The savepoints are released before the outer transaction ends, so hooks would run too early.
+		require.NoError(t, dbutils.Transaction(ctx, outer, func(tx pgx.Tx) error {
+			assert.Equal(t, dbutils.ErrHooksNotSupported, dbutils.OnCommit(tx, func(context.Context) error {
+				return nil
+			}))
+			assert.Equal(t, dbutils.ErrHooksNotSupported, dbutils.OnRollback(tx, func(context.Context) error {
+				return nil
+			}))
+			return dbutils.Transaction(ctx, tx, func(tx pgx.Tx) error {
+				assert.Equal(t, dbutils.ErrHooksNotSupported, dbutils.OnCommit(tx, func(context.Context) error {
+					return nil
+				}))
+				return nil
+			})
+		}))
+		require.NoError(t, outer.Rollback(ctx))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("hooks not supported", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		assert.Equal(t, dbutils.ErrHooksNotSupported, dbutils.OnCommit(mock, func(context.Context) error {
+			return nil
+		}))
+		assert.Equal(t, dbutils.ErrHooksNotSupported, dbutils.OnRollback(mock, func(context.Context) error {
+			return nil
+		}))
+	})
+}
@@ -0,0 +1,142 @@
+package dbutils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultIdempotencyTable is the name of the table Idempotent stores results in if no other one is configured.
+const DefaultIdempotencyTable = "idempotency_keys"
+
+const defaultIdempotencyTTL = 24 * time.Hour
+
+var (
+	ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+)
+
+type IdempotencyOptions struct {
+	table       string
+	ttl         time.Duration
+	fingerprint string
+	txOptions   []func(*Options)
+}
+
+// WithIdempotencyTable this option stores the results in the given table instead of DefaultIdempotencyTable.
+func WithIdempotencyTable(table string) func(*IdempotencyOptions) {
+	return func(i *IdempotencyOptions) {
+		i.table = table
+	}
+}
+
+// WithIdempotencyTTL this option configures how long a result is stored. After that, the key can be used again.
+func WithIdempotencyTTL(ttl time.Duration) func(*IdempotencyOptions) {
+	return func(i *IdempotencyOptions) {
+		i.ttl = ttl
+	}
+}
+
+// WithFingerprint this option stores a fingerprint of the request, e.g. a hash of its body, together with the result.
+// Using the key with a different fingerprint returns ErrIdempotencyKeyReused.
+func WithFingerprint(fingerprint string) func(*IdempotencyOptions) {
+	return func(i *IdempotencyOptions) {
+		i.fingerprint = fingerprint
+	}
+}
+
+// WithTransactionOptions this option configures the transaction Idempotent runs in, e.g. with WithLocker.
+func WithTransactionOptions(options ...func(*Options)) func(*IdempotencyOptions) {
+	return func(i *IdempotencyOptions) {
+		i.txOptions = append(i.txOptions, options...)
+	}
+}
+
+// IdempotencySchema returns the DDL that creates the table Idempotent stores results in.
+func IdempotencySchema(table string) string {
+	return fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			key text PRIMARY KEY,
+			fingerprint text NOT NULL,
+			result jsonb NOT NULL,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			expires_at timestamptz NOT NULL
+		);
+	`, pgx.Identifier{table}.Sanitize())
+}
+
+// Idempotent runs do at most once per key, e.g. for API requests that clients retry. The result of do is stored JSON
+// encoded in the same transaction, following calls with the key return the stored result instead of running do.
+// Concurrent calls with the key wait on an advisory lock until the first one is done. Errors of do are not stored, so
+// the next call runs do again.
+// The stored result is looked up after the lock was acquired, which requires the default read committed isolation.
+func Idempotent[T any](
+	ctx context.Context,
+	db Beginner,
+	key string,
+	do func(tx pgx.Tx) (T, error),
+	options ...func(*IdempotencyOptions),
+) (T, error) {
+	opts := &IdempotencyOptions{table: DefaultIdempotencyTable, ttl: defaultIdempotencyTTL}
+	for _, o := range options {
+		o(opts)
+	}
+	table := pgx.Identifier{opts.table}.Sanitize()
+	txOptions := append([]func(*Options){WithAdvisoryLock("idempotency/" + key)}, opts.txOptions...)
+	return TransactionResult(ctx, db, func(tx pgx.Tx) (T, error) {
+		var (
+			result      T
+			fingerprint string
+			stored      []byte
+		)
+		err := tx.QueryRow(
+			ctx,
+			"SELECT fingerprint, result FROM "+table+" WHERE key = $1 AND expires_at > now()",
+			key,
+		).Scan(&fingerprint, &stored)
+		switch {
+		case err == nil:
+			if fingerprint != opts.fingerprint {
+				return result, fmt.Errorf("%w: %s", ErrIdempotencyKeyReused, key)
+			}
+			if err := json.Unmarshal(stored, &result); err != nil {
+				return result, fmt.Errorf("could not decode stored result of idempotency key %s: %w", key, err)
+			}
+			return result, nil
+		case !errors.Is(err, pgx.ErrNoRows):
+			return result, fmt.Errorf("could not look up idempotency key %s: %w", key, err)
+		}
+
+		result, err = do(tx)
+		if err != nil {
+			return result, err
+		}
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			return result, fmt.Errorf("could not encode result of idempotency key %s: %w", key, err)
+		}
+		// An expired result of the key is replaced.
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO `+table+` (key, fingerprint, result, expires_at)
+			VALUES ($1, $2, $3, now() + $4 * interval '1 millisecond')
+			ON CONFLICT (key) DO UPDATE
+			SET fingerprint = excluded.fingerprint, result = excluded.result, created_at = excluded.created_at,
+				expires_at = excluded.expires_at
+		`, key, opts.fingerprint, encoded, opts.ttl.Milliseconds()); err != nil {
+			return result, fmt.Errorf("could not store result of idempotency key %s: %w", key, err)
+		}
+		return result, nil
+	}, txOptions...)
+}
+
+// DeleteExpiredIdempotencyKeys deletes the expired results from the given table and returns how many were deleted.
+func DeleteExpiredIdempotencyKeys(ctx context.Context, db PGXInterface, table string) (int64, error) {
+	tag, err := db.Exec(ctx, "DELETE FROM "+pgx.Identifier{table}.Sanitize()+" WHERE expires_at <= now()")
+	if err != nil {
+		return 0, fmt.Errorf("could not delete expired idempotency keys: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
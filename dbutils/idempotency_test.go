@@ -0,0 +1,160 @@
+package dbutils_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type payment struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+func TestIdempotent(t *testing.T) {
+	lockKey := dbutils.NewLocker().Key("idempotency/pay-1").Key
+	expectLookup := func(mock pgxmock.PgxConnIface) *pgxmock.ExpectedQuery {
+		mock.ExpectBegin()
+		mock.
+			ExpectExec("SELECT pg_advisory_xact_lock(?)").
+			WithArgs(lockKey).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		return mock.
+			ExpectQuery(`SELECT fingerprint, result FROM "idempotency_keys" WHERE key = \$1`).
+			WithArgs("pay-1")
+	}
+
+	t.Run("run and store", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		expectLookup(mock).WillReturnError(pgx.ErrNoRows)
+		mock.
+			ExpectExec(`INSERT INTO "idempotency_keys"`).
+			WithArgs("pay-1", "body-hash", []byte(`{"id":1,"status":"paid"}`), int64(3600000)).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectCommit()
+
+		result, err := dbutils.Idempotent(context.Background(), mock, "pay-1", func(pgx.Tx) (payment, error) {
+			return payment{ID: 1, Status: "paid"}, nil
+		}, dbutils.WithFingerprint("body-hash"), dbutils.WithIdempotencyTTL(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, payment{ID: 1, Status: "paid"}, result)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("stored result", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		expectLookup(mock).WillReturnRows(
+			mock.NewRows([]string{"fingerprint", "result"}).AddRow("", []byte(`{"id":1,"status":"paid"}`)),
+		)
+		mock.ExpectCommit()
+
+		result, err := dbutils.Idempotent(context.Background(), mock, "pay-1", func(pgx.Tx) (payment, error) {
+			t.Fatal("do must not run")
+			return payment{}, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, payment{ID: 1, Status: "paid"}, result)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("different fingerprint", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		expectLookup(mock).WillReturnRows(
+			mock.NewRows([]string{"fingerprint", "result"}).AddRow("body-hash", []byte(`{}`)),
+		)
+		mock.ExpectRollback()
+
+		_, err = dbutils.Idempotent(context.Background(), mock, "pay-1", func(pgx.Tx) (payment, error) {
+			t.Fatal("do must not run")
+			return payment{}, nil
+		}, dbutils.WithFingerprint("other-hash"))
+		assert.ErrorIs(t, err, dbutils.ErrIdempotencyKeyReused)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("errors are not stored", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		expectLookup(mock).WillReturnError(pgx.ErrNoRows)
+		mock.ExpectRollback()
+
+		declined := errors.New("declined")
+		result, err := dbutils.Idempotent(context.Background(), mock, "pay-1", func(pgx.Tx) (payment, error) {
+			return payment{ID: 1}, declined
+		})
+		assert.ErrorIs(t, err, declined)
+		assert.Equal(t, payment{}, result)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPGXIdempotent(t *testing.T) {
+	ctx := context.Background()
+	_, err := pgxPool.Exec(ctx, dbutils.IdempotencySchema(dbutils.DefaultIdempotencyTable))
+	require.NoError(t, err)
+
+	var (
+		runs    atomic.Int32
+		wg      sync.WaitGroup
+		results = make([]payment, 5)
+	)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := dbutils.Idempotent(ctx, pgxPool, "pay-2", func(pgx.Tx) (payment, error) {
+				// Keep the lock for a while, so the other calls have to wait.
+				time.Sleep(100 * time.Millisecond)
+				return payment{ID: int(runs.Add(1)), Status: "paid"}, nil
+			}, dbutils.WithFingerprint("body-hash"))
+			assert.NoError(t, err)
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), runs.Load())
+	for _, result := range results {
+		assert.Equal(t, payment{ID: 1, Status: "paid"}, result)
+	}
+
+	_, err = dbutils.Idempotent(ctx, pgxPool, "pay-2", func(pgx.Tx) (payment, error) {
+		return payment{}, nil
+	}, dbutils.WithFingerprint("other-hash"))
+	assert.ErrorIs(t, err, dbutils.ErrIdempotencyKeyReused)
+
+	// Expired results are replaced.
+	_, err = pgxPool.Exec(ctx, "UPDATE idempotency_keys SET expires_at = now() WHERE key = 'pay-2'")
+	require.NoError(t, err)
+	result, err := dbutils.Idempotent(ctx, pgxPool, "pay-2", func(pgx.Tx) (payment, error) {
+		return payment{ID: 2, Status: "paid"}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.ID)
+	deleted, err := dbutils.DeleteExpiredIdempotencyKeys(ctx, pgxPool, dbutils.DefaultIdempotencyTable)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), deleted)
+}
@@ -0,0 +1,54 @@
+// Package pgtest starts the Postgres container the integration tests of the dbutils packages run against.
+package pgtest
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/testsetup/container"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+// Main starts a Postgres container, stores a pool connected to it in pool, runs the tests and exits. It is meant to be
+// called by TestMain.
+func Main(m *testing.M, pool **pgxpool.Pool) {
+	// Setup container.
+	ctx := context.Background()
+	// Initialize postgres.
+	postgresContainer, err := postgres.Run(ctx,
+		"postgres:16-alpine",
+		postgres.WithDatabase("testing"),
+		postgres.WithUsername("test"),
+		postgres.WithPassword("test"),
+	)
+	if err != nil {
+		panic(err)
+	}
+	time.Sleep(time.Second * 2)
+	ports, err := postgresContainer.MappedPort(ctx, "5432")
+	if err != nil {
+		panic(err)
+	}
+	exposedPostgresPort := strings.Split(string(ports), "/")[0]
+	dbURL := "postgres://test:test@" + container.AutoGuessHostname() + ":" + exposedPostgresPort + "/testing"
+
+	// Build pgx pool
+	pgxCfg, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		panic(err)
+	}
+	pPool, err := pgxpool.NewWithConfig(context.Background(), pgxCfg)
+	if err != nil {
+		panic(err)
+	}
+	*pool = pPool
+	c := m.Run()
+	if err := postgresContainer.Stop(ctx, nil); err != nil {
+		panic(err)
+	}
+	os.Exit(c)
+}
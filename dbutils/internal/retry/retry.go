@@ -0,0 +1,29 @@
+// Package retry contains the helpers the packages of dbutils share to retry failed work.
+package retry
+
+import (
+	"strings"
+	"time"
+)
+
+// MaxErrorLength is the maximum length of the error messages ErrorMessage returns.
+const MaxErrorLength = 1024
+
+// Delay returns the exponential backoff after the given failed attempt. It starts at baseDelay, doubles with each
+// attempt and is capped at maxDelay.
+func Delay(attempt int, baseDelay, maxDelay time.Duration) time.Duration {
+	delay := baseDelay
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// ErrorMessage returns the message of err to be stored in the database, truncated to MaxErrorLength and valid text.
+func ErrorMessage(err error) string {
+	msg := err.Error()
+	if len(msg) > MaxErrorLength {
+		msg = msg[:MaxErrorLength]
+	}
+	return strings.ToValidUTF8(msg, "")
+}
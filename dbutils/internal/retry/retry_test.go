@@ -0,0 +1,35 @@
+package retry_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils/internal/retry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelay(t *testing.T) {
+	type TestCase struct {
+		attempt  int
+		expected time.Duration
+	}
+	testCases := []TestCase{
+		{attempt: 1, expected: time.Second},
+		{attempt: 2, expected: 2 * time.Second},
+		{attempt: 3, expected: 4 * time.Second},
+		{attempt: 4, expected: 5 * time.Second},
+		{attempt: 100, expected: 5 * time.Second},
+	}
+	for _, tt := range testCases {
+		assert.Equal(t, tt.expected, retry.Delay(tt.attempt, time.Second, 5*time.Second))
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	assert.Equal(t, "test", retry.ErrorMessage(errors.New("test")))
+	// The cut must not leave a broken multi-byte character.
+	msg := retry.ErrorMessage(errors.New(strings.Repeat("a", retry.MaxErrorLength-1) + "ä"))
+	assert.Equal(t, strings.Repeat("a", retry.MaxErrorLength-1), msg)
+}
@@ -0,0 +1,313 @@
+package dbutils
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid pagination cursor")
+)
+
+// SortOrder is the order of a SortColumn.
+type SortOrder int
+
+const (
+	Ascending SortOrder = iota
+	Descending
+)
+
+// SortColumn is a column a Paginator sorts by. Nullable columns may contain NULL, which is sorted after all values in
+// Ascending order and before all values in Descending order, like Postgres does by default.
+type SortColumn struct {
+	Name     string
+	Order    SortOrder
+	Nullable bool
+}
+
+// Paginator pages through the results of a query with keyset pagination. Other than with OFFSET, the database does
+// not have to skip the rows of the previous pages, so all pages are equally fast if the sort columns are indexed.
+type Paginator struct {
+	columns []SortColumn
+	key     []byte
+}
+
+// Page is a page of a Paginate result. Next and Prev are the cursors of the following and the preceding page, they
+// are empty if there is no such page.
+type Page[T any] struct {
+	Items []T
+	Next  string
+	Prev  string
+}
+
+// cursor is the decoded form of the cursors of a Page. Values are the sort column values of the row next to the page
+// in text format. An Inclusive cursor also selects the row with these values.
+type cursor struct {
+	Values    []*string `json:"v"`
+	Backward  bool      `json:"b,omitempty"`
+	Inclusive bool      `json:"i,omitempty"`
+}
+
+// NewPaginator creates a Paginator that sorts by the given columns. The columns have to identify a row uniquely, e.g.
+// by ending with the primary key, otherwise rows with equal values may be skipped.
+func NewPaginator(columns []SortColumn, options ...func(*Paginator)) *Paginator {
+	p := &Paginator{columns: columns}
+	for _, o := range options {
+		o(p)
+	}
+	return p
+}
+
+// WithCursorKey this option signs the cursors with HMAC-SHA256 and the given key, so tampered cursors are rejected
+// with ErrInvalidCursor.
+func WithCursorKey(key []byte) func(*Paginator) {
+	return func(p *Paginator) {
+		p.key = key
+	}
+}
+
+// Paginate returns the page of query that pageCursor points to. An empty pageCursor returns the first page. The
+// query must select the sort columns of the Paginator, its rows are scanned into T like by QueryAll. It is wrapped
+// into a sub query that is filtered by the cursor, sorted and limited to limit rows, so query must not be sorted or
+// limited itself. args are the arguments of query.
+func Paginate[T any](
+	ctx context.Context,
+	db PGXQueryInterface,
+	p *Paginator,
+	query string,
+	pageCursor string,
+	limit int,
+	args ...any,
+) (Page[T], error) {
+	if len(p.columns) == 0 {
+		return Page[T]{}, errors.New("paginate: no sort columns")
+	}
+	if limit <= 0 {
+		return Page[T]{}, errors.New("paginate: limit must be positive")
+	}
+	var current *cursor
+	if pageCursor != "" {
+		decoded, err := p.decode(pageCursor)
+		if err != nil {
+			return Page[T]{}, err
+		}
+		current = decoded
+	}
+	args, mode := scanMode(args)
+	sql, args := p.query(query, current, limit, args)
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	oids := make(map[string]uint32)
+	for _, field := range rows.FieldDescriptions() {
+		oids[strings.ToLower(field.Name)] = field.DataTypeOID
+	}
+	items, err := pgx.CollectRows(rows, rowToStruct[T](mode))
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	backward := current != nil && current.Backward
+	more := len(items) > limit
+	if more {
+		items = items[:limit]
+	}
+	if backward {
+		slices.Reverse(items)
+	}
+	var page Page[T]
+	page.Items = items
+	if len(items) == 0 {
+		// Going back from an empty page returns to the cursor, including the row it was built from.
+		if current != nil {
+			page.Prev, err = p.encode(&cursor{Values: current.Values, Backward: !backward, Inclusive: true})
+		}
+		return page, err
+	}
+	if !backward && more || backward {
+		if page.Next, err = p.cursorOf(items[len(items)-1], oids, false); err != nil {
+			return Page[T]{}, err
+		}
+	}
+	if backward && more || !backward && current != nil {
+		if page.Prev, err = p.cursorOf(items[0], oids, true); err != nil {
+			return Page[T]{}, err
+		}
+	}
+	return page, nil
+}
+
+// query wraps query into the keyset query for the page after or before c.
+func (p *Paginator) query(query string, c *cursor, limit int, args []any) (string, []any) {
+	backward := c != nil && c.Backward
+	var orderBy []string
+	for _, column := range p.columns {
+		orderBy = append(orderBy, "page."+pgx.Identifier{column.Name}.Sanitize()+p.orderOf(column, backward))
+	}
+	sql := "SELECT * FROM (" + query + ") AS page"
+	if c != nil {
+		var where string
+		where, args = p.where(c, args)
+		sql += " WHERE " + where
+	}
+	return fmt.Sprintf("%s ORDER BY %s LIMIT %d", sql, strings.Join(orderBy, ", "), limit+1), args
+}
+
+func (p *Paginator) orderOf(column SortColumn, backward bool) string {
+	if (column.Order == Descending) != backward {
+		return " DESC NULLS FIRST"
+	}
+	return " ASC NULLS LAST"
+}
+
+// where returns the condition that selects the rows after the cursor values, or before them if the cursor goes
+// backward. If no column is nullable and all have the same order, it is a tuple comparison, otherwise the expanded
+// form of it: (a > $1) OR (a = $1 AND b > $2) ... An inclusive cursor also selects the row equal to the values.
+func (p *Paginator) where(c *cursor, args []any) (string, []any) {
+	descending := func(column SortColumn) bool {
+		return (column.Order == Descending) != c.Backward
+	}
+	tuple := !slices.ContainsFunc(p.columns, func(column SortColumn) bool {
+		return column.Nullable || descending(column) != descending(p.columns[0])
+	})
+	if tuple {
+		var columns, params []string
+		for i, column := range p.columns {
+			args = append(args, *c.Values[i])
+			columns = append(columns, "page."+pgx.Identifier{column.Name}.Sanitize())
+			params = append(params, fmt.Sprintf("$%d", len(args)))
+		}
+		operator := ">"
+		if descending(p.columns[0]) {
+			operator = "<"
+		}
+		if c.Inclusive {
+			operator += "="
+		}
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), operator, strings.Join(params, ", ")), args
+	}
+
+	var (
+		alternatives []string
+		equals       []string
+	)
+	for i, column := range p.columns {
+		name := "page." + pgx.Identifier{column.Name}.Sanitize()
+		var after, equal string
+		switch value := c.Values[i]; {
+		// NULL is sorted after all values in ascending order.
+		case value == nil && descending(column):
+			after, equal = name+" IS NOT NULL", name+" IS NULL"
+		case value == nil:
+			after, equal = "", name+" IS NULL"
+		default:
+			args = append(args, *value)
+			operator := ">"
+			if descending(column) {
+				operator = "<"
+			}
+			after = fmt.Sprintf("%s %s $%d", name, operator, len(args))
+			if column.Nullable && !descending(column) {
+				after = "(" + after + " OR " + name + " IS NULL)"
+			}
+			equal = fmt.Sprintf("%s = $%d", name, len(args))
+		}
+		if after != "" {
+			alternatives = append(alternatives, "("+strings.Join(append(slices.Clone(equals), after), " AND ")+")")
+		}
+		equals = append(equals, equal)
+	}
+	if c.Inclusive {
+		alternatives = append(alternatives, "("+strings.Join(equals, " AND ")+")")
+	}
+	if len(alternatives) == 0 {
+		return "false", args
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// cursorOf returns the cursor of the page after or before item.
+func (p *Paginator) cursorOf(item any, oids map[string]uint32, backward bool) (string, error) {
+	v := reflect.ValueOf(item)
+	fields := fieldsOf(v.Type())
+	typeMap := pgtype.NewMap()
+	c := &cursor{Backward: backward}
+	for _, column := range p.columns {
+		name := strings.ToLower(column.Name)
+		field, ok := fields.byColumn[name]
+		if !ok {
+			return "", fmt.Errorf("paginate: sort column %s is not mapped to a field of %s", column.Name, v.Type())
+		}
+		var text *string
+		if value, ok := fieldValue(v, field.index); ok {
+			encoded, err := typeMap.Encode(oids[name], pgtype.TextFormatCode, value.Interface(), nil)
+			if err != nil {
+				return "", fmt.Errorf("paginate: could not encode sort column %s: %w", column.Name, err)
+			}
+			if encoded != nil {
+				s := string(encoded)
+				text = &s
+			}
+		}
+		c.Values = append(c.Values, text)
+	}
+	return p.encode(c)
+}
+
+// encode encodes c as URL safe base64. With a key, the HMAC of the payload is appended after a dot.
+func (p *Paginator) encode(c *cursor) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("paginate: could not encode cursor: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	if p.key != nil {
+		encoded += "." + base64.RawURLEncoding.EncodeToString(p.sign(payload))
+	}
+	return encoded, nil
+}
+
+func (p *Paginator) decode(encoded string) (*cursor, error) {
+	encodedPayload, encodedMAC, signed := strings.Cut(encoded, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	if p.key != nil {
+		mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+		if !signed || err != nil || !hmac.Equal(mac, p.sign(payload)) {
+			return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidCursor)
+		}
+	}
+	var c cursor
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	if len(c.Values) != len(p.columns) {
+		return nil, fmt.Errorf("%w: expected %d values, got %d", ErrInvalidCursor, len(p.columns), len(c.Values))
+	}
+	for i, column := range p.columns {
+		if c.Values[i] == nil && !column.Nullable {
+			return nil, fmt.Errorf("%w: %s must not be NULL", ErrInvalidCursor, column.Name)
+		}
+	}
+	return &c, nil
+}
+
+func (p *Paginator) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
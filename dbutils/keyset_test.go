@@ -0,0 +1,280 @@
+package dbutils_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ranked struct {
+	ID    int  `db:"id"`
+	Score *int `db:"score"`
+}
+
+func TestPaginate(t *testing.T) {
+	byID := dbutils.NewPaginator([]dbutils.SortColumn{{Name: "id"}})
+
+	t.Run("next and previous page", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectQuery(regexp.QuoteMeta(
+				`SELECT * FROM (SELECT id FROM ranked WHERE id > $1) AS page ORDER BY page."id" ASC NULLS LAST LIMIT 3`,
+			)).
+			WithArgs(0).
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+		mock.
+			ExpectQuery(regexp.QuoteMeta(
+				`SELECT * FROM (SELECT id FROM ranked WHERE id > $1) AS page WHERE (page."id") > ($2) `+
+					`ORDER BY page."id" ASC NULLS LAST LIMIT 3`,
+			)).
+			WithArgs(0, "2").
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(3))
+		mock.
+			ExpectQuery(regexp.QuoteMeta(
+				`SELECT * FROM (SELECT id FROM ranked WHERE id > $1) AS page WHERE (page."id") < ($2) `+
+					`ORDER BY page."id" DESC NULLS FIRST LIMIT 3`,
+			)).
+			WithArgs(0, "3").
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(2).AddRow(1))
+
+		ctx := context.Background()
+		query := "SELECT id FROM ranked WHERE id > $1"
+		first, err := dbutils.Paginate[ranked](ctx, mock, byID, query, "", 2, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []ranked{{ID: 1}, {ID: 2}}, first.Items)
+		assert.NotEmpty(t, first.Next)
+		assert.Empty(t, first.Prev)
+
+		second, err := dbutils.Paginate[ranked](ctx, mock, byID, query, first.Next, 2, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []ranked{{ID: 3}}, second.Items)
+		assert.Empty(t, second.Next)
+		assert.NotEmpty(t, second.Prev)
+
+		back, err := dbutils.Paginate[ranked](ctx, mock, byID, query, second.Prev, 2, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []ranked{{ID: 1}, {ID: 2}}, back.Items)
+		assert.NotEmpty(t, back.Next)
+		assert.Empty(t, back.Prev)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("previous page of an empty page", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectQuery(regexp.QuoteMeta(
+				`SELECT * FROM (SELECT id FROM ranked) AS page ORDER BY page."id" ASC NULLS LAST LIMIT 3`,
+			)).
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+		// The row is deleted before the next page is read.
+		mock.
+			ExpectQuery(regexp.QuoteMeta(
+				`SELECT * FROM (SELECT id FROM ranked) AS page WHERE (page."id") > ($1) ` +
+					`ORDER BY page."id" ASC NULLS LAST LIMIT 3`,
+			)).
+			WithArgs("2").
+			WillReturnRows(mock.NewRows([]string{"id"}))
+		mock.
+			ExpectQuery(regexp.QuoteMeta(
+				`SELECT * FROM (SELECT id FROM ranked) AS page WHERE (page."id") <= ($1) ` +
+					`ORDER BY page."id" DESC NULLS FIRST LIMIT 3`,
+			)).
+			WithArgs("2").
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(2).AddRow(1))
+
+		ctx := context.Background()
+		query := "SELECT id FROM ranked"
+		first, err := dbutils.Paginate[ranked](ctx, mock, byID, query, "", 2)
+		require.NoError(t, err)
+		empty, err := dbutils.Paginate[ranked](ctx, mock, byID, query, first.Next, 2)
+		require.NoError(t, err)
+		assert.Empty(t, empty.Items)
+		assert.Empty(t, empty.Next)
+		require.NotEmpty(t, empty.Prev)
+
+		back, err := dbutils.Paginate[ranked](ctx, mock, byID, query, empty.Prev, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []ranked{{ID: 1}, {ID: 2}}, back.Items)
+		assert.Empty(t, back.Prev)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("inclusive cursor with nullable columns", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectQuery(regexp.QuoteMeta(`SELECT * FROM (SELECT id, score FROM ranked) AS page ` +
+				`WHERE ((page."score" IS NOT NULL) OR (page."score" IS NULL AND page."id" > $1) OR ` +
+				`(page."score" IS NULL AND page."id" = $1)) ` +
+				`ORDER BY page."score" DESC NULLS FIRST, page."id" ASC NULLS LAST LIMIT 2`,
+			)).
+			WithArgs("8").
+			WillReturnRows(mock.NewRows([]string{"id", "score"}).AddRow(8, (*int)(nil)))
+
+		paginator := dbutils.NewPaginator([]dbutils.SortColumn{
+			{Name: "score", Nullable: true},
+			{Name: "id", Order: dbutils.Descending},
+		})
+		// {"v":[null,"8"],"b":true,"i":true}
+		cursor := "eyJ2IjpbbnVsbCwiOCJdLCJiIjp0cnVlLCJpIjp0cnVlfQ"
+		page, err := dbutils.Paginate[ranked](context.Background(), mock, paginator, "SELECT id, score FROM ranked",
+			cursor, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []ranked{{ID: 8}}, page.Items)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("nullable columns", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		score := 5
+		mock.
+			ExpectQuery(regexp.QuoteMeta(`SELECT * FROM (SELECT id, score FROM ranked) AS page ` +
+				`ORDER BY page."score" ASC NULLS LAST, page."id" DESC NULLS FIRST LIMIT 2`,
+			)).
+			WillReturnRows(mock.NewRows([]string{"id", "score"}).AddRow(7, &score).AddRow(8, (*int)(nil)))
+		mock.
+			ExpectQuery(regexp.QuoteMeta(`SELECT * FROM (SELECT id, score FROM ranked) AS page `+
+				`WHERE (((page."score" > $1 OR page."score" IS NULL)) OR (page."score" = $1 AND page."id" < $2)) `+
+				`ORDER BY page."score" ASC NULLS LAST, page."id" DESC NULLS FIRST LIMIT 2`,
+			)).
+			WithArgs("5", "7").
+			WillReturnRows(mock.NewRows([]string{"id", "score"}).AddRow(8, (*int)(nil)).AddRow(6, (*int)(nil)))
+		mock.
+			ExpectQuery(regexp.QuoteMeta(`SELECT * FROM (SELECT id, score FROM ranked) AS page ` +
+				`WHERE ((page."score" IS NULL AND page."id" < $1)) ` +
+				`ORDER BY page."score" ASC NULLS LAST, page."id" DESC NULLS FIRST LIMIT 2`,
+			)).
+			WithArgs("8").
+			WillReturnRows(mock.NewRows([]string{"id", "score"}).AddRow(6, (*int)(nil)))
+
+		ctx := context.Background()
+		paginator := dbutils.NewPaginator([]dbutils.SortColumn{
+			{Name: "score", Nullable: true},
+			{Name: "id", Order: dbutils.Descending},
+		})
+		query := "SELECT id, score FROM ranked"
+		page, err := dbutils.Paginate[ranked](ctx, mock, paginator, query, "", 1)
+		require.NoError(t, err)
+		assert.Equal(t, []ranked{{ID: 7, Score: &score}}, page.Items)
+		page, err = dbutils.Paginate[ranked](ctx, mock, paginator, query, page.Next, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []ranked{{ID: 8}}, page.Items)
+		page, err = dbutils.Paginate[ranked](ctx, mock, paginator, query, page.Next, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []ranked{{ID: 6}}, page.Items)
+		assert.Empty(t, page.Next)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("signed cursor", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectQuery("SELECT id FROM ranked").
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+
+		ctx := context.Background()
+		signed := dbutils.NewPaginator([]dbutils.SortColumn{{Name: "id"}}, dbutils.WithCursorKey([]byte("secret")))
+		page, err := dbutils.Paginate[ranked](ctx, mock, signed, "SELECT id FROM ranked", "", 1)
+		require.NoError(t, err)
+		require.NotEmpty(t, page.Next)
+		assert.NoError(t, mock.ExpectationsWereMet())
+
+		for _, cursor := range []string{
+			"not base64!",
+			"eyJ2IjpbIjEwMCJdfQ", // {"v":["100"]} without signature
+			"eyJ2IjpbIjEwMCJdfQ." + page.Next[len(page.Next)-43:], // signature of another payload
+		} {
+			_, err := dbutils.Paginate[ranked](ctx, mock, signed, "SELECT id FROM ranked", cursor, 1)
+			assert.ErrorIs(t, err, dbutils.ErrInvalidCursor, cursor)
+		}
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		for _, cursor := range []string{
+			"eyJ2IjpbXX0",      // {"v":[]}
+			"eyJ2IjpbbnVsbF19", // {"v":[null]} for a column that is not nullable
+		} {
+			_, err := dbutils.Paginate[ranked](context.Background(), nil, byID, "SELECT id FROM ranked", cursor, 1)
+			assert.ErrorIs(t, err, dbutils.ErrInvalidCursor, cursor)
+		}
+	})
+}
+
+func TestPGXPaginate(t *testing.T) {
+	ctx := context.Background()
+	err := dbutils.Transaction(ctx, pgxPool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO test (A, B) VALUES ('c', 2001), (NULL, 2002), ('a', 2003), (NULL, 2004), ('b', 2005)
+		`); err != nil {
+			return err
+		}
+		type row struct {
+			A *string `db:"a"`
+			B int     `db:"b"`
+		}
+		paginator := dbutils.NewPaginator(
+			[]dbutils.SortColumn{{Name: "a", Nullable: true}, {Name: "b", Order: dbutils.Descending}},
+			dbutils.WithCursorKey([]byte("secret")),
+		)
+		query := "SELECT a, b FROM test WHERE b > $1"
+
+		var (
+			forward []int
+			cursor  string
+		)
+		for {
+			page, err := dbutils.Paginate[row](ctx, tx, paginator, query, cursor, 2, 2000)
+			if err != nil {
+				return err
+			}
+			for _, item := range page.Items {
+				forward = append(forward, item.B)
+			}
+			if page.Next == "" {
+				break
+			}
+			cursor = page.Next
+		}
+		assert.Equal(t, []int{2003, 2005, 2001, 2004, 2002}, forward)
+
+		page, err := dbutils.Paginate[row](ctx, tx, paginator, query, cursor, 2, 2000)
+		if err != nil {
+			return err
+		}
+		page, err = dbutils.Paginate[row](ctx, tx, paginator, query, page.Prev, 2, 2000)
+		if err != nil {
+			return err
+		}
+		assert.Len(t, page.Items, 2)
+		assert.Equal(t, 2001, page.Items[0].B)
+		assert.Equal(t, 2004, page.Items[1].B)
+		return errors.New("roll back")
+	})
+	assert.EqualError(t, err, "transaction rollback: roll back")
+}
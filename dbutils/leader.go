@@ -0,0 +1,202 @@
+package dbutils
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultHealthCheckInterval = 5 * time.Second
+	defaultElectionInterval    = 5 * time.Second
+)
+
+// ElectorConn is the dedicated connection a LeaderElector holds its lock on, e.g. *pgx.Conn.
+type ElectorConn interface {
+	PGXConnInterface
+	Ping(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+// LeaderElector elects exactly one leader among all electors using the same lockID, e.g. several replicas of a
+// scheduler. The leader holds a session level advisory lock on a dedicated connection. If the connection dies, the
+// leadership is given up, so another elector can take over.
+type LeaderElector struct {
+	connect             func(ctx context.Context) (ElectorConn, error)
+	lockID              string
+	locker              *Locker
+	onElected           func(ctx context.Context)
+	onRevoked           func()
+	healthCheckInterval time.Duration
+	electionInterval    time.Duration
+
+	leader     atomic.Bool
+	resign     chan struct{}
+	resignOnce sync.Once
+	done       chan struct{}
+}
+
+// NewLeaderElector creates a LeaderElector that opens its dedicated connections with connect.
+func NewLeaderElector(
+	connect func(ctx context.Context) (ElectorConn, error),
+	lockID string,
+	options ...func(*LeaderElector),
+) *LeaderElector {
+	e := &LeaderElector{
+		connect:             connect,
+		lockID:              lockID,
+		locker:              defaultLocker,
+		onElected:           func(context.Context) {},
+		onRevoked:           func() {},
+		healthCheckInterval: defaultHealthCheckInterval,
+		electionInterval:    defaultElectionInterval,
+		resign:              make(chan struct{}),
+		done:                make(chan struct{}),
+	}
+	for _, o := range options {
+		o(e)
+	}
+	return e
+}
+
+// PGXConnect returns a connect function for NewLeaderElector that opens a *pgx.Conn with the given config.
+func PGXConnect(config *pgx.ConnConfig) func(ctx context.Context) (ElectorConn, error) {
+	return func(ctx context.Context) (ElectorConn, error) {
+		return pgx.ConnectConfig(ctx, config.Copy())
+	}
+}
+
+// WithOnElected this option configures the callback that is called when the elector becomes the leader. ctx is
+// cancelled as soon as the leadership is lost. The callback must not block, long-running work should be started in a
+// goroutine that stops with ctx.
+// The work is not fenced: ctx is only cancelled after the failed health check, up to two health check intervals after
+// the connection was lost, while another elector may be the leader already. Writes that must never happen twice need
+// their own protection, e.g. a transaction with WithAdvisoryLock.
+func WithOnElected(onElected func(ctx context.Context)) func(*LeaderElector) {
+	return func(e *LeaderElector) {
+		e.onElected = onElected
+	}
+}
+
+// WithOnRevoked this option configures the callback that is called when the elector is not the leader anymore.
+func WithOnRevoked(onRevoked func()) func(*LeaderElector) {
+	return func(e *LeaderElector) {
+		e.onRevoked = onRevoked
+	}
+}
+
+// WithHealthCheckInterval this option configures how often the leader checks its connection.
+func WithHealthCheckInterval(interval time.Duration) func(*LeaderElector) {
+	return func(e *LeaderElector) {
+		e.healthCheckInterval = interval
+	}
+}
+
+// WithElectionInterval this option configures how often an elector tries to become the leader.
+func WithElectionInterval(interval time.Duration) func(*LeaderElector) {
+	return func(e *LeaderElector) {
+		e.electionInterval = interval
+	}
+}
+
+// WithElectorLocker this option computes the key of the leader lock with the given Locker.
+func WithElectorLocker(locker *Locker) func(*LeaderElector) {
+	return func(e *LeaderElector) {
+		e.locker = locker
+	}
+}
+
+// IsLeader reports whether the elector is the leader right now.
+func (e *LeaderElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run takes part in the election until ctx is cancelled or Resign is called. It must be called once per elector.
+// Errors of the connection are not returned, the elector reconnects instead. Run returns ctx.Err() if ctx was
+// cancelled and nil after Resign.
+func (e *LeaderElector) Run(ctx context.Context) error {
+	defer close(e.done)
+	for {
+		if conn, err := e.connect(ctx); err == nil {
+			_ = e.elect(ctx, conn)
+			_ = conn.Close(context.WithoutCancel(ctx))
+		}
+		if !e.wait(ctx, e.electionInterval) {
+			return ctx.Err()
+		}
+	}
+}
+
+// Resign gives up the leadership and stops Run. It waits until Run returned or ctx is done.
+func (e *LeaderElector) Resign(ctx context.Context) error {
+	e.resignOnce.Do(func() {
+		close(e.resign)
+	})
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// elect tries to become the leader on conn until the connection fails, ctx is done or the elector resigned.
+func (e *LeaderElector) elect(ctx context.Context, conn ElectorConn) error {
+	call, args := e.locker.Key(e.lockID).call("pg_try_advisory_lock")
+	for {
+		var acquired bool
+		if err := conn.QueryRow(ctx, "SELECT "+call, args...).Scan(&acquired); err != nil {
+			return err
+		}
+		if acquired {
+			return e.lead(ctx, conn)
+		}
+		if !e.wait(ctx, e.electionInterval) {
+			return ctx.Err()
+		}
+	}
+}
+
+// lead holds the leadership until the connection fails, ctx is done or the elector resigned.
+func (e *LeaderElector) lead(ctx context.Context, conn ElectorConn) error {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	e.leader.Store(true)
+	defer func() {
+		cancel()
+		e.leader.Store(false)
+		e.onRevoked()
+	}()
+	e.onElected(leaderCtx)
+	for {
+		if !e.wait(ctx, e.healthCheckInterval) {
+			// Release the lock explicitly, so the next leader does not have to wait for the connection to close.
+			call, args := e.locker.Key(e.lockID).call("pg_advisory_unlock")
+			_, _ = conn.Exec(context.WithoutCancel(ctx), "SELECT "+call, args...)
+			return ctx.Err()
+		}
+		// A connection that is gone without being closed properly may block Ping until the TCP timeout.
+		pingCtx, cancelPing := context.WithTimeout(ctx, e.healthCheckInterval)
+		err := conn.Ping(pingCtx)
+		cancelPing()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// wait waits for d. It returns false if ctx is done or the elector resigned in the meantime.
+func (e *LeaderElector) wait(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-e.resign:
+		return false
+	}
+}
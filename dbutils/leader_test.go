@@ -0,0 +1,205 @@
+package dbutils_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaderElector(t *testing.T) {
+	lockRows := func(mock pgxmock.PgxConnIface, acquired bool) *pgxmock.Rows {
+		return mock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(acquired)
+	}
+	connectTo := func(mock pgxmock.PgxConnIface) func(context.Context) (dbutils.ElectorConn, error) {
+		var connected bool
+		return func(context.Context) (dbutils.ElectorConn, error) {
+			if connected {
+				return nil, errors.New("connection refused")
+			}
+			connected = true
+			return mock, nil
+		}
+	}
+
+	t.Run("resign releases the lock", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.
+			ExpectQuery("SELECT pg_try_advisory_lock(?)").
+			WithArgs(int64(-4578387130389545126)).
+			WillReturnRows(lockRows(mock, false))
+		mock.
+			ExpectQuery("SELECT pg_try_advisory_lock(?)").
+			WithArgs(int64(-4578387130389545126)).
+			WillReturnRows(lockRows(mock, true))
+		mock.
+			ExpectExec("SELECT pg_advisory_unlock(?)").
+			WithArgs(int64(-4578387130389545126)).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		mock.ExpectClose()
+
+		elected := make(chan struct{})
+		var revoked bool
+		elector := dbutils.NewLeaderElector(
+			connectTo(mock),
+			"test1",
+			dbutils.WithElectionInterval(time.Millisecond),
+			dbutils.WithHealthCheckInterval(time.Hour),
+			dbutils.WithOnElected(func(context.Context) {
+				close(elected)
+			}),
+			dbutils.WithOnRevoked(func() {
+				revoked = true
+			}),
+		)
+		result := make(chan error)
+		go func() {
+			result <- elector.Run(context.Background())
+		}()
+
+		<-elected
+		assert.True(t, elector.IsLeader())
+		require.NoError(t, elector.Resign(context.Background()))
+		assert.NoError(t, <-result)
+		assert.False(t, elector.IsLeader())
+		assert.True(t, revoked)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("revoke on failed health check", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.
+			ExpectQuery("SELECT pg_try_advisory_lock(?)").
+			WithArgs(int64(-4578387130389545126)).
+			WillReturnRows(lockRows(mock, true))
+		mock.ExpectPing()
+		mock.ExpectPing().WillReturnError(errors.New("connection lost"))
+		mock.ExpectClose()
+
+		var leaderCtx context.Context
+		revoked := make(chan struct{})
+		elector := dbutils.NewLeaderElector(
+			connectTo(mock),
+			"test1",
+			dbutils.WithElectionInterval(time.Millisecond),
+			dbutils.WithHealthCheckInterval(time.Millisecond),
+			dbutils.WithOnElected(func(ctx context.Context) {
+				leaderCtx = ctx
+			}),
+			dbutils.WithOnRevoked(func() {
+				close(revoked)
+			}),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		result := make(chan error)
+		go func() {
+			result <- elector.Run(ctx)
+		}()
+
+		<-revoked
+		assert.ErrorIs(t, leaderCtx.Err(), context.Canceled)
+		cancel()
+		assert.ErrorIs(t, <-result, context.Canceled)
+		assert.False(t, elector.IsLeader())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("revoke on hanging health check", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.
+			ExpectQuery("SELECT pg_try_advisory_lock(?)").
+			WithArgs(int64(-4578387130389545126)).
+			WillReturnRows(lockRows(mock, true))
+		// A broken connection may not answer at all.
+		mock.ExpectPing().WillDelayFor(time.Hour)
+		mock.ExpectClose()
+
+		revoked := make(chan struct{})
+		elector := dbutils.NewLeaderElector(
+			connectTo(mock),
+			"test1",
+			dbutils.WithHealthCheckInterval(time.Millisecond),
+			dbutils.WithOnRevoked(func() {
+				close(revoked)
+			}),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		result := make(chan error)
+		go func() {
+			result <- elector.Run(ctx)
+		}()
+
+		select {
+		case <-revoked:
+		case <-time.After(5 * time.Second):
+			t.Fatal("leadership was not revoked")
+		}
+		cancel()
+		assert.ErrorIs(t, <-result, context.Canceled)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPGXLeaderElector(t *testing.T) {
+	ctx := context.Background()
+	var (
+		mu      sync.Mutex
+		leaders int
+		elected = make(chan *dbutils.LeaderElector, 3)
+	)
+	electors := make([]*dbutils.LeaderElector, 3)
+	for i := range electors {
+		var elector *dbutils.LeaderElector
+		elector = dbutils.NewLeaderElector(
+			dbutils.PGXConnect(pgxPool.Config().ConnConfig),
+			"leader",
+			dbutils.WithElectionInterval(10*time.Millisecond),
+			dbutils.WithHealthCheckInterval(10*time.Millisecond),
+			dbutils.WithOnElected(func(context.Context) {
+				mu.Lock()
+				defer mu.Unlock()
+				leaders++
+				assert.Equal(t, 1, leaders, "more than one leader")
+				elected <- elector
+			}),
+			dbutils.WithOnRevoked(func() {
+				mu.Lock()
+				defer mu.Unlock()
+				leaders--
+			}),
+		)
+		electors[i] = elector
+		go func() {
+			assert.NoError(t, elector.Run(ctx))
+		}()
+	}
+
+	first := <-elected
+	assert.True(t, first.IsLeader())
+	// Give the other electors some rounds to try to become the leader as well.
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, first.Resign(ctx))
+
+	second := <-elected
+	assert.NotSame(t, first, second)
+	assert.True(t, second.IsLeader())
+	for _, elector := range electors {
+		require.NoError(t, elector.Resign(ctx))
+	}
+	assert.Equal(t, 0, leaders)
+}
@@ -0,0 +1,224 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	defaultListenerBaseDelay   = 100 * time.Millisecond
+	defaultListenerMaxDelay    = 30 * time.Second
+	defaultNotificationBuffer  = 64
+	defaultListenerHealthCheck = 30 * time.Second
+)
+
+// ListenerConn is the dedicated connection a Listener listens on, e.g. *pgx.Conn.
+type ListenerConn interface {
+	PGXInterface
+	WaitForNotification(ctx context.Context) (*pgconn.Notification, error)
+	Ping(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+// Notification is a notification a Listener received on one of its channels.
+type Notification struct {
+	Channel string
+	Payload string
+	// PID is the process id of the server session that sent the notification.
+	PID uint32
+	// PossiblyMissed is set on the notification every channel gets after the Listener reconnected. Notifications that
+	// were sent while it was disconnected are lost, so consumers should e.g. invalidate their whole cache. It has no
+	// payload.
+	PossiblyMissed bool
+}
+
+// Listener receives the notifications of several channels with LISTEN on a dedicated connection. If the connection
+// fails, it reconnects with an exponential backoff, listens on all channels again and delivers a Notification with
+// PossiblyMissed to every channel.
+type Listener struct {
+	connect             func(ctx context.Context) (ListenerConn, error)
+	handlers            map[string][]func(ctx context.Context, n Notification)
+	channels            []chan Notification
+	backoff             RetryOptions
+	healthCheckInterval time.Duration
+	bufferSize          int
+	onError             func(err error)
+	listened            bool
+}
+
+// NewListener creates a Listener that opens its dedicated connections with connect.
+func NewListener(connect func(ctx context.Context) (ListenerConn, error), options ...func(*Listener)) *Listener {
+	l := &Listener{
+		connect:             connect,
+		handlers:            make(map[string][]func(ctx context.Context, n Notification)),
+		backoff:             RetryOptions{baseDelay: defaultListenerBaseDelay, maxDelay: defaultListenerMaxDelay},
+		healthCheckInterval: defaultListenerHealthCheck,
+		bufferSize:          defaultNotificationBuffer,
+		onError:             func(error) {},
+	}
+	for _, o := range options {
+		o(l)
+	}
+	return l
+}
+
+// PGXListenerConnect returns a connect function for NewListener that opens a *pgx.Conn with the given config.
+func PGXListenerConnect(config *pgx.ConnConfig) func(ctx context.Context) (ListenerConn, error) {
+	return func(ctx context.Context) (ListenerConn, error) {
+		return pgx.ConnectConfig(ctx, config.Copy())
+	}
+}
+
+// WithListenerBackoff this option configures the exponential backoff between two connection attempts. It behaves
+// like WithBackoff.
+func WithListenerBackoff(baseDelay, maxDelay time.Duration) func(*Listener) {
+	return func(l *Listener) {
+		l.backoff.baseDelay = baseDelay
+		l.backoff.maxDelay = maxDelay
+	}
+}
+
+// WithListenerHealthCheckInterval this option configures after how long without notifications the Listener checks
+// its connection.
+func WithListenerHealthCheckInterval(interval time.Duration) func(*Listener) {
+	return func(l *Listener) {
+		l.healthCheckInterval = interval
+	}
+}
+
+// WithNotificationBufferSize this option configures the buffer size of the Go channels returned by Listen.
+func WithNotificationBufferSize(size int) func(*Listener) {
+	return func(l *Listener) {
+		l.bufferSize = size
+	}
+}
+
+// WithOnListenerError this option configures a callback for the connection errors Run reconnects after, e.g. to log
+// them.
+func WithOnListenerError(onError func(err error)) func(*Listener) {
+	return func(l *Listener) {
+		l.onError = onError
+	}
+}
+
+// Handle registers handler for the notifications of channel. Handlers are called one after another by Run, so they
+// should return quickly. Handle must be called before Run.
+func (l *Listener) Handle(channel string, handler func(ctx context.Context, n Notification)) {
+	l.handlers[channel] = append(l.handlers[channel], handler)
+}
+
+// Listen returns a Go channel that receives the notifications of channel. If its buffer is full, Run waits until
+// there is space again, while the server queues further notifications. The Go channel is closed when Run returns.
+// Listen must be called before Run.
+func (l *Listener) Listen(channel string) <-chan Notification {
+	notifications := make(chan Notification, l.bufferSize)
+	l.channels = append(l.channels, notifications)
+	l.Handle(channel, func(ctx context.Context, n Notification) {
+		select {
+		case notifications <- n:
+		case <-ctx.Done():
+		}
+	})
+	return notifications
+}
+
+// Run listens until ctx is cancelled and returns ctx.Err(). It must be called once per Listener. Errors of the
+// connection are not returned, the Listener reconnects instead.
+func (l *Listener) Run(ctx context.Context) error {
+	defer func() {
+		for _, notifications := range l.channels {
+			close(notifications)
+		}
+	}()
+	if len(l.handlers) == 0 {
+		return errors.New("listener: no channels")
+	}
+	for attempt := 1; ; attempt++ {
+		conn, err := l.connect(ctx)
+		if err == nil {
+			var listened bool
+			listened, err = l.listen(ctx, conn)
+			_ = conn.Close(context.WithoutCancel(ctx))
+			if listened {
+				attempt = 1
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		l.onError(err)
+		timer := time.NewTimer(l.backoff.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// listen listens on all channels of conn and delivers the notifications until the connection fails or ctx is done.
+// It reports whether LISTEN succeeded.
+func (l *Listener) listen(ctx context.Context, conn ListenerConn) (bool, error) {
+	channels := make([]string, 0, len(l.handlers))
+	for channel := range l.handlers {
+		channels = append(channels, channel)
+	}
+	slices.Sort(channels)
+	for _, channel := range channels {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return false, fmt.Errorf("could not listen on %s: %w", channel, err)
+		}
+	}
+	// Notifications sent before LISTEN succeeded on the new connection are lost.
+	if l.listened {
+		for _, channel := range channels {
+			l.deliver(ctx, Notification{Channel: channel, PossiblyMissed: true})
+		}
+	}
+	l.listened = true
+
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, l.healthCheckInterval)
+		n, err := conn.WaitForNotification(waitCtx)
+		cancel()
+		switch {
+		case ctx.Err() != nil:
+			return true, ctx.Err()
+		case errors.Is(err, context.DeadlineExceeded):
+			// Nothing was received for a while, the connection may be gone without being closed properly. Then Ping
+			// may block until the TCP timeout.
+			pingCtx, cancelPing := context.WithTimeout(ctx, l.healthCheckInterval)
+			err := conn.Ping(pingCtx)
+			cancelPing()
+			if err != nil {
+				return true, fmt.Errorf("listener connection is broken: %w", err)
+			}
+		case err != nil:
+			return true, fmt.Errorf("could not receive notification: %w", err)
+		default:
+			l.deliver(ctx, Notification{Channel: n.Channel, Payload: n.Payload, PID: n.PID})
+		}
+	}
+}
+
+func (l *Listener) deliver(ctx context.Context, n Notification) {
+	for _, handler := range l.handlers[n.Channel] {
+		handler(ctx, n)
+	}
+}
+
+// Notify sends payload to channel with pg_notify. If tx is a transaction, e.g. the one passed by Transaction, the
+// notification is only delivered when it commits, and not at all if it rolls back.
+func Notify(ctx context.Context, tx PGXInterface, channel, payload string) error {
+	if _, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", channel, payload); err != nil {
+		return fmt.Errorf("could not notify %s: %w", channel, err)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package dbutils_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeListenerConn delivers the notifications sent on its channel and fails with the errors sent on fail. If hang is
+// set, Ping blocks until ctx is done, like on a connection that is gone.
+type fakeListenerConn struct {
+	mu            sync.Mutex
+	statements    []string
+	notifications chan *pgconn.Notification
+	fail          chan error
+	hang          bool
+}
+
+func newFakeListenerConn() *fakeListenerConn {
+	return &fakeListenerConn{notifications: make(chan *pgconn.Notification), fail: make(chan error)}
+}
+
+func (c *fakeListenerConn) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.statements = append(c.statements, sql)
+	return pgconn.NewCommandTag("LISTEN"), nil
+}
+
+func (c *fakeListenerConn) WaitForNotification(ctx context.Context) (*pgconn.Notification, error) {
+	select {
+	case n := <-c.notifications:
+		return n, nil
+	case err := <-c.fail:
+		return nil, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *fakeListenerConn) Ping(ctx context.Context) error {
+	if c.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+func (c *fakeListenerConn) Close(context.Context) error {
+	return nil
+}
+
+func (c *fakeListenerConn) listened() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.statements
+}
+
+func TestListener(t *testing.T) {
+	t.Run("reconnect", func(t *testing.T) {
+		first, second := newFakeListenerConn(), newFakeListenerConn()
+		conns := []dbutils.ListenerConn{first, nil, second}
+		var connectErrors []error
+		listener := dbutils.NewListener(
+			func(context.Context) (dbutils.ListenerConn, error) {
+				conn := conns[0]
+				conns = conns[1:]
+				if conn == nil {
+					return nil, errors.New("connection refused")
+				}
+				return conn, nil
+			},
+			dbutils.WithListenerBackoff(time.Millisecond, time.Millisecond),
+			dbutils.WithOnListenerError(func(err error) {
+				connectErrors = append(connectErrors, err)
+			}),
+		)
+		users := listener.Listen("users")
+		var orders []dbutils.Notification
+		listener.Handle("Orders", func(_ context.Context, n dbutils.Notification) {
+			orders = append(orders, n)
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		result := make(chan error)
+		go func() {
+			result <- listener.Run(ctx)
+		}()
+
+		first.notifications <- &pgconn.Notification{PID: 1, Channel: "users", Payload: "1"}
+		assert.Equal(t, dbutils.Notification{Channel: "users", Payload: "1", PID: 1}, <-users)
+		first.fail <- errors.New("connection reset")
+
+		assert.Equal(t, dbutils.Notification{Channel: "users", PossiblyMissed: true}, <-users)
+		second.notifications <- &pgconn.Notification{PID: 2, Channel: "users", Payload: "2"}
+		assert.Equal(t, dbutils.Notification{Channel: "users", Payload: "2", PID: 2}, <-users)
+		cancel()
+		assert.ErrorIs(t, <-result, context.Canceled)
+		_, open := <-users
+		assert.False(t, open)
+
+		assert.Equal(t, []string{`LISTEN "Orders"`, `LISTEN "users"`}, first.listened())
+		assert.Equal(t, []string{`LISTEN "Orders"`, `LISTEN "users"`}, second.listened())
+		assert.Equal(t, []dbutils.Notification{{Channel: "Orders", PossiblyMissed: true}}, orders)
+		require.Len(t, connectErrors, 2)
+		assert.EqualError(t, connectErrors[0], "could not receive notification: connection reset")
+		assert.EqualError(t, connectErrors[1], "connection refused")
+	})
+
+	t.Run("reconnect on hanging health check", func(t *testing.T) {
+		first, second := newFakeListenerConn(), newFakeListenerConn()
+		first.hang = true
+		conns := []dbutils.ListenerConn{first, second}
+		var connectErrors []error
+		listener := dbutils.NewListener(
+			func(context.Context) (dbutils.ListenerConn, error) {
+				conn := conns[0]
+				conns = conns[1:]
+				return conn, nil
+			},
+			dbutils.WithListenerBackoff(time.Millisecond, time.Millisecond),
+			dbutils.WithListenerHealthCheckInterval(time.Millisecond),
+			dbutils.WithOnListenerError(func(err error) {
+				connectErrors = append(connectErrors, err)
+			}),
+		)
+		users := listener.Listen("users")
+		ctx, cancel := context.WithCancel(context.Background())
+		result := make(chan error)
+		go func() {
+			result <- listener.Run(ctx)
+		}()
+
+		select {
+		case n := <-users:
+			assert.Equal(t, dbutils.Notification{Channel: "users", PossiblyMissed: true}, n)
+		case <-time.After(5 * time.Second):
+			t.Fatal("listener did not reconnect")
+		}
+		cancel()
+		assert.ErrorIs(t, <-result, context.Canceled)
+		require.Len(t, connectErrors, 1)
+		assert.ErrorIs(t, connectErrors[0], context.DeadlineExceeded)
+	})
+
+	t.Run("no channels", func(t *testing.T) {
+		listener := dbutils.NewListener(nil)
+		assert.EqualError(t, listener.Run(context.Background()), "listener: no channels")
+	})
+}
+
+func TestNotify(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close(context.Background())
+	mock.
+		ExpectExec(regexp.QuoteMeta("SELECT pg_notify($1, $2)")).
+		WithArgs("users", "1").
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+
+	require.NoError(t, dbutils.Notify(context.Background(), mock, "users", "1"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPGXListener(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := dbutils.NewListener(
+		dbutils.PGXListenerConnect(pgxPool.Config().ConnConfig),
+		dbutils.WithListenerBackoff(10*time.Millisecond, 10*time.Millisecond),
+	)
+	invalidations := listener.Listen("invalidate")
+	result := make(chan error)
+	go func() {
+		result <- listener.Run(ctx)
+	}()
+
+	// Wait until the listener is listening.
+	require.Eventually(t, func() bool {
+		if err := dbutils.Notify(ctx, pgxPool, "invalidate", "ready"); err != nil {
+			return false
+		}
+		select {
+		case <-invalidations:
+			return true
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	err := dbutils.Transaction(ctx, pgxPool, func(tx pgx.Tx) error {
+		if err := dbutils.Notify(ctx, tx, "invalidate", "rolled back"); err != nil {
+			return err
+		}
+		return errors.New("roll back")
+	})
+	require.EqualError(t, err, "transaction rollback: roll back")
+	err = dbutils.Transaction(ctx, pgxPool, func(tx pgx.Tx) error {
+		return dbutils.Notify(ctx, tx, "invalidate", "committed")
+	})
+	require.NoError(t, err)
+	// Skip the remaining ready notifications. The rolled back one must never be delivered.
+	for n := range invalidations {
+		assert.NotEqual(t, "rolled back", n.Payload)
+		if n.Payload == "committed" {
+			break
+		}
+	}
+
+	_, err = pgxPool.Exec(ctx, `
+		SELECT pg_terminate_backend(pid) FROM pg_stat_activity
+		WHERE query LIKE 'LISTEN%' AND pid <> pg_backend_pid()
+	`)
+	require.NoError(t, err)
+	assert.True(t, (<-invalidations).PossiblyMissed)
+
+	cancel()
+	assert.ErrorIs(t, <-result, context.Canceled)
+}
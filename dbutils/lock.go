@@ -3,32 +3,158 @@ package dbutils
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 
-	"hash/fnv"
-
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 
 	"github.com/4ND3R50N/go-tools/filter"
 )
 
+// AcquiredLocks is a handle to session level locks, see NewPGXSessionLocks. IDs contains the locks that are still held.
+// It is not safe for concurrent use, just like the connection it is bound to.
 type AcquiredLocks struct {
 	IDs []string
+
+	conn   PGXConnInterface
+	locker *Locker
+	shared bool
+}
+
+// TryLockResult reports which of the requested advisory locks were obtained and which are held by someone else.
+type TryLockResult struct {
+	Acquired  []string
+	Contended []string
 }
 
 type PGXInterface interface {
 	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
 }
 
+type PGXRowInterface interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 // NewPGXLocks acquire pg_advisory_xact_lock locks for each lockID given. Duplicates in lockIDs getting filtered out.
+// The locks are acquired in LockOrder, so transactions locking the same keys in a different order do not deadlock.
 func NewPGXLocks(ctx context.Context, db PGXInterface, lockIDs ...string) error {
-	lockIDs = filter.Distinct(lockIDs)
-	for _, id := range lockIDs {
-		resourceHash := fnv.New64()
-		_, _ = resourceHash.Write([]byte(id))
-		_, err := db.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", int64(resourceHash.Sum64()))
-		if err != nil {
+	return defaultLocker.Lock(ctx, db, lockIDs...)
+}
+
+// NewPGXSharedLocks acquire pg_advisory_xact_lock_shared locks for each lockID given. Shared locks only conflict with
+// exclusive locks on the same lockID, so many readers can hold them at the same time. Duplicates in lockIDs getting
+// filtered out.
+func NewPGXSharedLocks(ctx context.Context, db PGXInterface, lockIDs ...string) error {
+	return defaultLocker.LockShared(ctx, db, lockIDs...)
+}
+
+// NewPGXLocksBatched behaves like NewPGXLocks, but acquires all locks in a single round trip to the database.
+func NewPGXLocksBatched(ctx context.Context, db PGXInterface, lockIDs ...string) error {
+	return defaultLocker.LockBatched(ctx, db, lockIDs...)
+}
+
+// LockOrder returns the distinct lockIDs in the order they are acquired in, which is sorted by their lock key, see
+// LockKey.Compare.
+func LockOrder(lockIDs ...string) []string {
+	return defaultLocker.Order(lockIDs...)
+}
+
+// TryPGXLocks tries to acquire pg_try_advisory_xact_lock locks for each lockID given without waiting. Locks that are
+// held by someone else are reported as contended. Duplicates in lockIDs getting filtered out, the others are tried in
+// LockOrder.
+func TryPGXLocks(ctx context.Context, db PGXRowInterface, lockIDs ...string) (TryLockResult, error) {
+	return defaultLocker.TryLock(ctx, db, lockIDs...)
+}
+
+// TryPGXLocksAll behaves like TryPGXLocks, but stops at the first contended lock and returns ErrCouldNotAcquireLock.
+// Transaction level locks can not be released on their own, so the transaction should be rolled back in that case.
+func TryPGXLocksAll(ctx context.Context, db PGXRowInterface, lockIDs ...string) (TryLockResult, error) {
+	return defaultLocker.TryLockAll(ctx, db, lockIDs...)
+}
+
+// Lock behaves like NewPGXLocks with the keys of the Locker.
+func (l *Locker) Lock(ctx context.Context, db PGXInterface, lockIDs ...string) error {
+	return l.locks(ctx, db, lockIDs, nil, false)
+}
+
+// LockShared behaves like NewPGXSharedLocks with the keys of the Locker.
+func (l *Locker) LockShared(ctx context.Context, db PGXInterface, lockIDs ...string) error {
+	return l.locks(ctx, db, nil, lockIDs, false)
+}
+
+// LockBatched behaves like NewPGXLocksBatched with the keys of the Locker.
+func (l *Locker) LockBatched(ctx context.Context, db PGXInterface, lockIDs ...string) error {
+	return l.locks(ctx, db, lockIDs, nil, true)
+}
+
+// Order behaves like LockOrder with the keys of the Locker.
+func (l *Locker) Order(lockIDs ...string) []string {
+	ordered := filter.Distinct(lockIDs)
+	slices.SortStableFunc(ordered, func(a, b string) int {
+		return l.Key(a).Compare(l.Key(b))
+	})
+	return ordered
+}
+
+// TryLock behaves like TryPGXLocks with the keys of the Locker.
+func (l *Locker) TryLock(ctx context.Context, db PGXRowInterface, lockIDs ...string) (TryLockResult, error) {
+	return l.tryLocks(ctx, db, false, lockIDs)
+}
+
+// TryLockAll behaves like TryPGXLocksAll with the keys of the Locker.
+func (l *Locker) TryLockAll(ctx context.Context, db PGXRowInterface, lockIDs ...string) (TryLockResult, error) {
+	return l.tryLocks(ctx, db, true, lockIDs)
+}
+
+// locks acquires the exclusive and shared transaction level locks together in lock order. Keys that are locked
+// exclusively are not locked shared as well.
+func (l *Locker) locks(ctx context.Context, db PGXInterface, exclusive, shared []string, batched bool) error {
+	var statements []string
+	for _, id := range l.Order(append(slices.Clone(exclusive), shared...)...) {
+		lockFunc := "pg_advisory_xact_lock"
+		if !slices.Contains(exclusive, id) {
+			lockFunc = "pg_advisory_xact_lock_shared"
+		}
+		if batched {
+			// Without arguments pgx uses the simple protocol, which runs the statements one after another.
+			statements = append(statements, "SELECT "+l.Key(id).literal(lockFunc)+";")
+			continue
+		}
+		call, args := l.Key(id).call(lockFunc)
+		if _, err := db.Exec(ctx, "SELECT "+call, args...); err != nil {
+			return fmt.Errorf("could not acquire database advisory lock: %w", err)
+		}
+	}
+	if len(statements) > 0 {
+		if _, err := db.Exec(ctx, strings.Join(statements, " ")); err != nil {
 			return fmt.Errorf("could not acquire database advisory lock: %w", err)
 		}
 	}
 	return nil
 }
+
+func (l *Locker) tryLocks(
+	ctx context.Context,
+	db PGXRowInterface,
+	allOrNothing bool,
+	lockIDs []string,
+) (TryLockResult, error) {
+	var result TryLockResult
+	for _, id := range l.Order(lockIDs...) {
+		var acquired bool
+		call, args := l.Key(id).call("pg_try_advisory_xact_lock")
+		if err := db.QueryRow(ctx, "SELECT "+call, args...).Scan(&acquired); err != nil {
+			return result, fmt.Errorf("could not acquire database advisory lock: %w", err)
+		}
+		if !acquired {
+			result.Contended = append(result.Contended, id)
+			if allOrNothing {
+				return result, ErrCouldNotAcquireLock
+			}
+			continue
+		}
+		result.Acquired = append(result.Acquired, id)
+	}
+	return result, nil
+}
@@ -0,0 +1,146 @@
+package dbutils
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+var (
+	ErrLockKeyCollision = errors.New("advisory lock keys collide")
+)
+
+// KeyHasher hashes a lockID to the key of an advisory lock.
+type KeyHasher func(lockID string) uint64
+
+// FNV64Hasher hashes lockIDs with FNV-64. It is the default KeyHasher.
+func FNV64Hasher(lockID string) uint64 {
+	resourceHash := fnv.New64()
+	_, _ = resourceHash.Write([]byte(lockID))
+	return resourceHash.Sum64()
+}
+
+// LockKey is the key an advisory lock is taken on. Without a namespace it is the single bigint Key, with a namespace
+// it is the two int32 form of ClassID and ObjID. Postgres keeps both forms apart, so they never collide.
+type LockKey struct {
+	Key        int64
+	ClassID    int32
+	ObjID      int32
+	Namespaced bool
+}
+
+// call returns the parameterized call of the given advisory lock function with the key.
+func (k LockKey) call(lockFunc string) (string, []any) {
+	if k.Namespaced {
+		return lockFunc + "($1, $2)", []any{k.ClassID, k.ObjID}
+	}
+	return lockFunc + "($1)", []any{k.Key}
+}
+
+// literal returns the call of the given advisory lock function with the key inlined.
+func (k LockKey) literal(lockFunc string) string {
+	if k.Namespaced {
+		return fmt.Sprintf("%s(%d, %d)", lockFunc, k.ClassID, k.ObjID)
+	}
+	return fmt.Sprintf("%s(%d)", lockFunc, k.Key)
+}
+
+// Compare returns -1, 0 or +1 depending on whether k is acquired before, together with or after other. Locks are
+// always acquired in this order, see LockOrder. Code that takes further locks while holding others, e.g. session
+// level locks inside a Transaction with advisory locks, should follow it as well to avoid deadlocks.
+func (k LockKey) Compare(other LockKey) int {
+	return cmp.Or(
+		cmp.Compare(k.ClassID, other.ClassID),
+		cmp.Compare(k.ObjID, other.ObjID),
+		cmp.Compare(k.Key, other.Key),
+	)
+}
+
+// Locker computes the keys of advisory locks. The package level lock functions use a Locker with FNV64Hasher and no
+// namespace.
+type Locker struct {
+	hasher     KeyHasher
+	classID    int32
+	namespaced bool
+}
+
+var defaultLocker = NewLocker()
+
+// NewLocker creates a Locker with the given options.
+func NewLocker(options ...func(*Locker)) *Locker {
+	l := &Locker{hasher: FNV64Hasher}
+	for _, o := range options {
+		o(l)
+	}
+	return l
+}
+
+// WithHasher this option configures the hasher of lockIDs.
+func WithHasher(hasher KeyHasher) func(*Locker) {
+	return func(l *Locker) {
+		l.hasher = hasher
+	}
+}
+
+// WithNamespace this option takes locks in the two int32 form pg_advisory_xact_lock(classid, objid), where classid is
+// derived from the namespace. This keeps the locks apart from other applications using the same database.
+func WithNamespace(namespace string) func(*Locker) {
+	resourceHash := fnv.New32a()
+	_, _ = resourceHash.Write([]byte(namespace))
+	return WithNamespaceID(int32(resourceHash.Sum32()))
+}
+
+// WithNamespaceID behaves like WithNamespace, but takes the classid directly.
+func WithNamespaceID(classID int32) func(*Locker) {
+	return func(l *Locker) {
+		l.classID = classID
+		l.namespaced = true
+	}
+}
+
+// Key returns the LockKey of the lockID.
+func (l *Locker) Key(lockID string) LockKey {
+	hash := l.hasher(lockID)
+	if l.namespaced {
+		// Fold the hash, so all of its bits are considered.
+		return LockKey{ClassID: l.classID, ObjID: int32(uint32(hash) ^ uint32(hash>>32)), Namespaced: true}
+	}
+	return LockKey{Key: int64(hash)}
+}
+
+// LockRegistry detects lockIDs whose keys collide. Register all lockIDs of the application at startup, so two
+// different resources never share a lock by accident.
+type LockRegistry struct {
+	locker *Locker
+	mu     sync.Mutex
+	keys   map[LockKey]string
+}
+
+// NewLockRegistry creates a LockRegistry for the keys of the given Locker.
+func NewLockRegistry(locker *Locker) *LockRegistry {
+	return &LockRegistry{locker: locker, keys: make(map[LockKey]string)}
+}
+
+// Register registers the lockIDs. It returns ErrLockKeyCollision if the key of a lockID was registered for another
+// lockID already.
+func (r *LockRegistry) Register(lockIDs ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range lockIDs {
+		key := r.locker.Key(id)
+		if registered, ok := r.keys[key]; ok && registered != id {
+			return fmt.Errorf("%w: %q and %q", ErrLockKeyCollision, registered, id)
+		}
+		r.keys[key] = id
+	}
+	return nil
+}
+
+// MustRegister behaves like Register, but panics on collisions.
+func (r *LockRegistry) MustRegister(lockIDs ...string) {
+	if err := r.Register(lockIDs...); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,84 @@
+package dbutils_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocker(t *testing.T) {
+	t.Run("default key", func(t *testing.T) {
+		assert.Equal(t,
+			dbutils.LockKey{Key: -4578387130389545126},
+			dbutils.NewLocker().Key("test1"))
+	})
+
+	t.Run("custom hasher", func(t *testing.T) {
+		locker := dbutils.NewLocker(dbutils.WithHasher(func(lockID string) uint64 {
+			return uint64(len(lockID))
+		}))
+		assert.Equal(t, dbutils.LockKey{Key: 5}, locker.Key("test1"))
+		assert.Equal(t, []string{"a", "bb"}, locker.Order("bb", "a"))
+	})
+
+	t.Run("namespace", func(t *testing.T) {
+		locker := dbutils.NewLocker(
+			dbutils.WithNamespaceID(7),
+			dbutils.WithHasher(func(_ string) uint64 {
+				return 0x0000000300000001
+			}),
+		)
+		assert.Equal(t, dbutils.LockKey{ClassID: 7, ObjID: 2, Namespaced: true}, locker.Key("test1"))
+		assert.Equal(t,
+			dbutils.NewLocker(dbutils.WithNamespace("app")).Key("test1").ClassID,
+			dbutils.NewLocker(dbutils.WithNamespace("app")).Key("test2").ClassID)
+		assert.NotEqual(t,
+			dbutils.NewLocker(dbutils.WithNamespace("app")).Key("test1").ClassID,
+			dbutils.NewLocker(dbutils.WithNamespace("other app")).Key("test1").ClassID)
+
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.
+			ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1, $2)")).
+			WithArgs(int32(7), int32(2)).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		mock.ExpectCommit()
+		require.NoError(t, dbutils.Transaction(context.Background(), mock, func(_ pgx.Tx) error {
+			return nil
+		}, dbutils.WithLocker(locker), dbutils.WithAdvisoryLock("test1")))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestLockRegistry(t *testing.T) {
+	locker := dbutils.NewLocker(dbutils.WithHasher(func(lockID string) uint64 {
+		return uint64(len(lockID))
+	}))
+
+	t.Run("register distinct keys", func(t *testing.T) {
+		registry := dbutils.NewLockRegistry(locker)
+		assert.NoError(t, registry.Register("a", "bb", "a"))
+		assert.NoError(t, registry.Register("ccc"))
+	})
+
+	t.Run("detect collisions", func(t *testing.T) {
+		registry := dbutils.NewLockRegistry(locker)
+		require.NoError(t, registry.Register("a"))
+		err := registry.Register("b")
+		assert.ErrorIs(t, err, dbutils.ErrLockKeyCollision)
+		assert.Equal(t, `advisory lock keys collide: "a" and "b"`, err.Error())
+		assert.Panics(t, func() {
+			registry.MustRegister("c")
+		})
+	})
+}
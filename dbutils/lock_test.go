@@ -3,10 +3,12 @@ package dbutils_test
 import (
 	"context"
 	"errors"
+	"regexp"
 
 	"testing"
 
 	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/jackc/pgx/v5"
 	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stretchr/testify/assert"
 )
@@ -18,13 +20,14 @@ func TestNewPGXLocks(t *testing.T) {
 			t.Fatal(err)
 		}
 		defer mock.Close()
+		// Locks are acquired in LockOrder, so test2 comes first.
 		mock.
 			ExpectExec("SELECT pg_advisory_xact_lock(?)").
-			WithArgs(int64(-4578387130389545126)).
+			WithArgs(int64(-4578387130389545127)).
 			WillReturnResult(pgxmock.NewResult("test", 1))
 		mock.
 			ExpectExec("SELECT pg_advisory_xact_lock(?)").
-			WithArgs(int64(-4578387130389545127)).
+			WithArgs(int64(-4578387130389545126)).
 			WillReturnResult(pgxmock.NewResult("test", 1))
 		assert.NoError(t, dbutils.NewPGXLocks(context.Background(), mock, "test1", "test2"))
 	})
@@ -38,9 +41,152 @@ func TestNewPGXLocks(t *testing.T) {
 		someError := errors.New("some error")
 		mock.
 			ExpectExec("SELECT pg_advisory_xact_lock(?)").
-			WithArgs(int64(-4578387130389545126)).
+			WithArgs(int64(-4578387130389545127)).
 			WillReturnError(err)
 		assert.ErrorAs(t,
 			dbutils.NewPGXLocks(context.Background(), mock, "test1", "test2"), &someError)
 	})
 }
+
+func TestTryPGXLocks(t *testing.T) {
+	lockRows := func(mock pgxmock.PgxPoolIface, acquired bool) *pgxmock.Rows {
+		return mock.NewRows([]string{"pg_try_advisory_xact_lock"}).AddRow(acquired)
+	}
+
+	t.Run("report acquired and contended locks", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.
+			ExpectQuery("SELECT pg_try_advisory_xact_lock(?)").
+			WithArgs(int64(-4578387130389545127)).
+			WillReturnRows(lockRows(mock, true))
+		mock.
+			ExpectQuery("SELECT pg_try_advisory_xact_lock(?)").
+			WithArgs(int64(-4578387130389545126)).
+			WillReturnRows(lockRows(mock, false))
+		result, err := dbutils.TryPGXLocks(context.Background(), mock, "test1", "test2", "test1")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"test2"}, result.Acquired)
+		assert.Equal(t, []string{"test1"}, result.Contended)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("all or nothing", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.
+			ExpectQuery("SELECT pg_try_advisory_xact_lock(?)").
+			WithArgs(int64(-4578387130389545128)).
+			WillReturnRows(lockRows(mock, true))
+		mock.
+			ExpectQuery("SELECT pg_try_advisory_xact_lock(?)").
+			WithArgs(int64(-4578387130389545127)).
+			WillReturnRows(lockRows(mock, false))
+		result, err := dbutils.TryPGXLocksAll(context.Background(), mock, "test1", "test2", "test3")
+		assert.Equal(t, dbutils.ErrCouldNotAcquireLock, err)
+		assert.Equal(t, []string{"test3"}, result.Acquired)
+		assert.Equal(t, []string{"test2"}, result.Contended)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("transaction option", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.
+			ExpectQuery("SELECT pg_try_advisory_xact_lock(?)").
+			WithArgs(int64(-4578387130389545126)).
+			WillReturnRows(lockRows(mock, false))
+		mock.ExpectRollback()
+		err = dbutils.Transaction(context.Background(), mock, func(_ pgx.Tx) error {
+			t.Error("should not be called")
+			return nil
+		}, dbutils.WithTryAdvisoryLock("test1"))
+		assert.ErrorIs(t, err, dbutils.ErrCouldNotAcquireLock)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestNewPGXSharedLocks(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+	mock.
+		ExpectExec("SELECT pg_advisory_xact_lock_shared(?)").
+		WithArgs(int64(-4578387130389545126)).
+		WillReturnResult(pgxmock.NewResult("test", 1))
+	assert.NoError(t, dbutils.NewPGXSharedLocks(context.Background(), mock, "test1", "test1"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLockOrder(t *testing.T) {
+	assert.Equal(t, []string{"test3", "test2", "test1"}, dbutils.LockOrder("test1", "test3", "test2", "test1"))
+	assert.Equal(t, dbutils.LockOrder("a", "b"), dbutils.LockOrder("b", "a"))
+	assert.Empty(t, dbutils.LockOrder())
+	locker := dbutils.NewLocker()
+	assert.Equal(t, -1, locker.Key("test3").Compare(locker.Key("test1")))
+	assert.Equal(t, 0, locker.Key("test1").Compare(locker.Key("test1")))
+	assert.Equal(t, 1, locker.Key("test1").Compare(locker.Key("test2")))
+}
+
+func TestNewPGXLocksBatched(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+	mock.
+		ExpectExec(regexp.QuoteMeta(
+			"SELECT pg_advisory_xact_lock(-4578387130389545127); SELECT pg_advisory_xact_lock(-4578387130389545126);",
+		)).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	assert.NoError(t, dbutils.NewPGXLocksBatched(context.Background(), mock, "test1", "test2"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransactionLockOrder(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+	mock.ExpectBegin()
+	mock.
+		ExpectExec("SELECT pg_advisory_xact_lock_shared(?)").
+		WithArgs(int64(-4578387130389545128)).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.
+		ExpectExec("SELECT pg_advisory_xact_lock(?)").
+		WithArgs(int64(-4578387130389545127)).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.
+		ExpectExec("SELECT pg_advisory_xact_lock(?)").
+		WithArgs(int64(-4578387130389545126)).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectCommit()
+	var order []string
+	assert.NoError(t, dbutils.Transaction(context.Background(), mock, func(_ pgx.Tx) error {
+		return nil
+	},
+		dbutils.WithAdvisoryLock("test1"),
+		dbutils.WithSharedAdvisoryLock("test3"),
+		dbutils.WithSharedAdvisoryLock("test2"),
+		dbutils.WithAdvisoryLock("test2"),
+		dbutils.WithOnLocked(func(lockIDs []string) {
+			order = lockIDs
+		}),
+	))
+	assert.Equal(t, []string{"test3", "test2", "test1"}, order)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,321 @@
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+)
+
+const (
+	// DefaultTable is the name of the history table if no other one is configured.
+	DefaultTable = "schema_migrations"
+	// DefaultLockID is the id of the advisory lock that serializes Up if no other one is configured.
+	DefaultLockID = "dbutils/migrate"
+)
+
+var (
+	ErrInvalidMigration = errors.New("invalid migration")
+	ErrDrift            = errors.New("migrations do not match the applied history")
+)
+
+// DriftError is returned if the migration files do not match the history table. It matches ErrDrift.
+type DriftError struct {
+	Version int64
+	Name    string
+	Reason  string
+}
+
+func (e *DriftError) Error() string {
+	return fmt.Sprintf("migration %d %s: %s", e.Version, e.Name, e.Reason)
+}
+
+func (e *DriftError) Is(target error) bool {
+	return target == ErrDrift
+}
+
+// Conn is the dedicated connection a Migrator holds its lock on, e.g. *pgx.Conn.
+type Conn interface {
+	dbutils.PGXConnInterface
+	dbutils.PGXQueryInterface
+	dbutils.Beginner
+}
+
+// Migration is a versioned SQL file. Its file name is <version>_<name>.sql, e.g. 0001_create_users.sql.
+type Migration struct {
+	Version int64
+	Name    string
+	SQL     string
+	// Checksum is the hex encoded SHA-256 of SQL.
+	Checksum string
+}
+
+// State is the state of a migration as reported by Migrator.Status.
+type State struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	// Drift is a *DriftError if the migration does not match the history, e.g. because its file was changed after it
+	// was applied.
+	Drift error
+}
+
+// Migrator applies the migrations of a directory to a database. Several Migrators, e.g. of replicas starting at the
+// same time, can run Up concurrently, the advisory lock lets them apply the migrations one after another.
+type Migrator struct {
+	conn       Conn
+	migrations []Migration
+	table      string
+	lockID     string
+	locker     *dbutils.Locker
+	onApplied  func(migration Migration, duration time.Duration)
+}
+
+// New creates a Migrator that applies the .sql files in the root of fsys to conn. Use fs.Sub for other directories.
+func New(conn Conn, fsys fs.FS, options ...func(*Migrator)) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	m := &Migrator{
+		conn:       conn,
+		migrations: migrations,
+		table:      DefaultTable,
+		lockID:     DefaultLockID,
+		locker:     dbutils.NewLocker(),
+		onApplied:  func(Migration, time.Duration) {},
+	}
+	for _, o := range options {
+		o(m)
+	}
+	return m, nil
+}
+
+// WithTable this option records the applied migrations in the given table instead of DefaultTable.
+func WithTable(table string) func(*Migrator) {
+	return func(m *Migrator) {
+		m.table = table
+	}
+}
+
+// WithLockID this option serializes Up with the given advisory lock id instead of DefaultLockID.
+func WithLockID(lockID string) func(*Migrator) {
+	return func(m *Migrator) {
+		m.lockID = lockID
+	}
+}
+
+// WithLocker this option computes the key of the advisory lock with the given Locker.
+func WithLocker(locker *dbutils.Locker) func(*Migrator) {
+	return func(m *Migrator) {
+		m.locker = locker
+	}
+}
+
+// WithOnApplied this option configures a callback that is called after each applied migration, e.g. to log it.
+func WithOnApplied(onApplied func(migration Migration, duration time.Duration)) func(*Migrator) {
+	return func(m *Migrator) {
+		m.onApplied = onApplied
+	}
+}
+
+// Load reads the migrations from the .sql files in the root of fsys, sorted by version. Other files are ignored.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("could not read migrations: %w", err)
+	}
+	var migrations []Migration
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if !ok || err != nil || name == "" {
+			return nil, fmt.Errorf("%w: %s is not named <version>_<name>.sql", ErrInvalidMigration, entry.Name())
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("could not read migration %s: %w", entry.Name(), err)
+		}
+		checksum := sha256.Sum256(content)
+		migrations = append(migrations, Migration{
+			Version:  version,
+			Name:     name,
+			SQL:      string(content),
+			Checksum: hex.EncodeToString(checksum[:]),
+		})
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("%w: version %d is used by %s and %s", ErrInvalidMigration,
+				migrations[i].Version, migrations[i-1].Name, migrations[i].Name)
+		}
+	}
+	return migrations, nil
+}
+
+// Status returns the state of all migrations, the ones of the files and the applied ones, sorted by version. It does
+// not fail on drift, but reports it in State.Drift.
+func (m *Migrator) Status(ctx context.Context) ([]State, error) {
+	applied, err := m.history(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		states []State
+		latest int64
+	)
+	for _, state := range applied {
+		latest = max(latest, state.Version)
+	}
+	for _, migration := range m.migrations {
+		state, ok := applied[migration.Version]
+		if !ok {
+			state = State{Migration: migration}
+			if migration.Version < latest {
+				state.Drift = &DriftError{
+					Version: migration.Version,
+					Name:    migration.Name,
+					Reason:  fmt.Sprintf("is pending, but migration %d is already applied", latest),
+				}
+			}
+		} else if state.Checksum != migration.Checksum {
+			state.Drift = &DriftError{Version: migration.Version, Name: migration.Name, Reason: "checksum changed"}
+		}
+		state.SQL = migration.SQL
+		states = append(states, state)
+		delete(applied, migration.Version)
+	}
+	for _, state := range applied {
+		state.Drift = &DriftError{Version: state.Version, Name: state.Name, Reason: "is applied, but has no file"}
+		states = append(states, state)
+	}
+	slices.SortFunc(states, func(a, b State) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return states, nil
+}
+
+// Plan returns the pending migrations Up would apply, without applying them. If the migrations drifted from the
+// history, it returns the DriftErrors joined.
+func (m *Migrator) Plan(ctx context.Context) ([]Migration, error) {
+	states, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		pending []Migration
+		drift   []error
+	)
+	for _, state := range states {
+		if state.Drift != nil {
+			drift = append(drift, state.Drift)
+		} else if !state.Applied {
+			pending = append(pending, state.Migration)
+		}
+	}
+	if len(drift) > 0 {
+		return nil, errors.Join(drift...)
+	}
+	return pending, nil
+}
+
+// Up applies the pending migrations in the order of their versions and returns them. Each migration is applied in its
+// own dbutils.Transaction together with its history entry, so statements that cannot run in a transaction, like
+// CREATE INDEX CONCURRENTLY, are not supported. Up holds a session level advisory lock on the connection while it
+// runs. It refuses to apply anything if the migrations drifted from the history.
+func (m *Migrator) Up(ctx context.Context) (applied []Migration, err error) {
+	locks, err := m.locker.SessionLock(ctx, m.conn, m.lockID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = errors.Join(err, locks.ReleaseAll(context.WithoutCancel(ctx)))
+	}()
+	if _, err := m.conn.Exec(ctx, m.schema()); err != nil {
+		return nil, fmt.Errorf("could not create migration history %s: %w", m.table, err)
+	}
+	pending, err := m.Plan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, migration := range pending {
+		start := time.Now()
+		if err := dbutils.Transaction(ctx, m.conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, migration.SQL); err != nil {
+				return err
+			}
+			_, err := tx.Exec(
+				ctx,
+				"INSERT INTO "+pgx.Identifier{m.table}.Sanitize()+" (version, name, checksum) VALUES ($1, $2, $3)",
+				migration.Version,
+				migration.Name,
+				migration.Checksum,
+			)
+			return err
+		}); err != nil {
+			return applied, fmt.Errorf("could not apply migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		m.onApplied(migration, time.Since(start))
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
+
+func (m *Migrator) schema() string {
+	return fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			version bigint PRIMARY KEY,
+			name text NOT NULL,
+			checksum text NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)
+	`, pgx.Identifier{m.table}.Sanitize())
+}
+
+// history returns the applied migrations by version. It does not create the history table, so Status and Plan do
+// not write anything.
+func (m *Migrator) history(ctx context.Context) (map[int64]State, error) {
+	table := pgx.Identifier{m.table}.Sanitize()
+	var exists bool
+	if err := m.conn.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", table).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("could not read migration history %s: %w", m.table, err)
+	}
+	applied := make(map[int64]State)
+	if !exists {
+		return applied, nil
+	}
+	rows, err := m.conn.Query(ctx, "SELECT version, name, checksum, applied_at FROM "+table)
+	if err != nil {
+		return nil, fmt.Errorf("could not read migration history %s: %w", m.table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		state := State{Applied: true}
+		if err := rows.Scan(&state.Version, &state.Name, &state.Checksum, &state.AppliedAt); err != nil {
+			return nil, fmt.Errorf("could not read migration history %s: %w", m.table, err)
+		}
+		applied[state.Version] = state
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not read migration history %s: %w", m.table, err)
+	}
+	return applied, nil
+}
@@ -0,0 +1,200 @@
+package migrate_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/4ND3R50N/go-tools/dbutils/migrate"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var migrations = fstest.MapFS{
+	"0002_add_email.sql":    {Data: []byte("ALTER TABLE users ADD COLUMN email text;")},
+	"0001_create_users.sql": {Data: []byte("CREATE TABLE users (id int PRIMARY KEY);")},
+	"README.md":             {Data: []byte("# Migrations")},
+}
+
+func checksum(fsys fstest.MapFS, name string) string {
+	sum := sha256.Sum256(fsys[name].Data)
+	return hex.EncodeToString(sum[:])
+}
+
+func lockKey() int64 {
+	return dbutils.NewLocker().Key(migrate.DefaultLockID).Key
+}
+
+func historyRows(mock pgxmock.PgxConnIface) *pgxmock.Rows {
+	return mock.NewRows([]string{"version", "name", "checksum", "applied_at"})
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("sorted by version", func(t *testing.T) {
+		loaded, err := migrate.Load(migrations)
+		require.NoError(t, err)
+		require.Len(t, loaded, 2)
+		assert.Equal(t, migrate.Migration{
+			Version:  1,
+			Name:     "create_users",
+			SQL:      "CREATE TABLE users (id int PRIMARY KEY);",
+			Checksum: checksum(migrations, "0001_create_users.sql"),
+		}, loaded[0])
+		assert.Equal(t, int64(2), loaded[1].Version)
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		_, err := migrate.Load(fstest.MapFS{"create_users.sql": {}})
+		assert.ErrorIs(t, err, migrate.ErrInvalidMigration)
+	})
+
+	t.Run("duplicate version", func(t *testing.T) {
+		_, err := migrate.Load(fstest.MapFS{"1_a.sql": {}, "01_b.sql": {}})
+		assert.ErrorIs(t, err, migrate.ErrInvalidMigration)
+	})
+}
+
+func TestMigratorUp(t *testing.T) {
+	t.Run("applies pending migrations", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock($1)")).
+			WithArgs(lockKey()).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		mock.
+			ExpectExec(`CREATE TABLE IF NOT EXISTS "schema_migrations"`).
+			WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+		mock.
+			ExpectQuery(regexp.QuoteMeta("SELECT to_regclass($1) IS NOT NULL")).
+			WithArgs(`"schema_migrations"`).
+			WillReturnRows(mock.NewRows([]string{"exists"}).AddRow(true))
+		mock.
+			ExpectQuery(`SELECT version, name, checksum, applied_at FROM "schema_migrations"`).
+			WillReturnRows(historyRows(mock).
+				AddRow(int64(1), "create_users", checksum(migrations, "0001_create_users.sql"), time.Now()),
+			)
+		mock.ExpectBegin()
+		mock.
+			ExpectExec(regexp.QuoteMeta("ALTER TABLE users ADD COLUMN email text;")).
+			WillReturnResult(pgxmock.NewResult("ALTER TABLE", 0))
+		mock.
+			ExpectExec(regexp.QuoteMeta(`INSERT INTO "schema_migrations" (version, name, checksum) VALUES ($1, $2, $3)`)).
+			WithArgs(int64(2), "add_email", checksum(migrations, "0002_add_email.sql")).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectCommit()
+		mock.
+			ExpectQuery(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).
+			WithArgs(lockKey()).
+			WillReturnRows(mock.NewRows([]string{"pg_advisory_unlock"}).AddRow(true))
+
+		var logged []int64
+		migrator, err := migrate.New(mock, migrations, migrate.WithOnApplied(func(m migrate.Migration, _ time.Duration) {
+			logged = append(logged, m.Version)
+		}))
+		require.NoError(t, err)
+		applied, err := migrator.Up(context.Background())
+		require.NoError(t, err)
+		require.Len(t, applied, 1)
+		assert.Equal(t, "add_email", applied[0].Name)
+		assert.Equal(t, []int64{2}, logged)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("refuses to run on drift", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock($1)")).
+			WithArgs(lockKey()).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		mock.
+			ExpectExec(`CREATE TABLE IF NOT EXISTS "schema_migrations"`).
+			WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+		mock.
+			ExpectQuery(regexp.QuoteMeta("SELECT to_regclass($1) IS NOT NULL")).
+			WithArgs(`"schema_migrations"`).
+			WillReturnRows(mock.NewRows([]string{"exists"}).AddRow(true))
+		mock.
+			ExpectQuery(`SELECT version, name, checksum, applied_at FROM "schema_migrations"`).
+			WillReturnRows(historyRows(mock).AddRow(int64(1), "create_users", "edited", time.Now()))
+		mock.
+			ExpectQuery(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).
+			WithArgs(lockKey()).
+			WillReturnRows(mock.NewRows([]string{"pg_advisory_unlock"}).AddRow(true))
+
+		migrator, err := migrate.New(mock, migrations)
+		require.NoError(t, err)
+		applied, err := migrator.Up(context.Background())
+		assert.ErrorIs(t, err, migrate.ErrDrift)
+		assert.ErrorContains(t, err, "migration 1 create_users: checksum changed")
+		assert.Empty(t, applied)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMigratorStatus(t *testing.T) {
+	t.Run("without history", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectQuery(regexp.QuoteMeta("SELECT to_regclass($1) IS NOT NULL")).
+			WithArgs(`"history"`).
+			WillReturnRows(mock.NewRows([]string{"exists"}).AddRow(false))
+
+		migrator, err := migrate.New(mock, migrations, migrate.WithTable("history"))
+		require.NoError(t, err)
+		pending, err := migrator.Plan(context.Background())
+		require.NoError(t, err)
+		require.Len(t, pending, 2)
+		assert.Equal(t, int64(1), pending[0].Version)
+		assert.Equal(t, int64(2), pending[1].Version)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("drift", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectQuery(regexp.QuoteMeta("SELECT to_regclass($1) IS NOT NULL")).
+			WithArgs(`"schema_migrations"`).
+			WillReturnRows(mock.NewRows([]string{"exists"}).AddRow(true))
+		mock.
+			ExpectQuery(`SELECT version, name, checksum, applied_at FROM "schema_migrations"`).
+			WillReturnRows(historyRows(mock).
+				AddRow(int64(2), "add_email", checksum(migrations, "0002_add_email.sql"), time.Now()).
+				AddRow(int64(3), "deleted", "checksum", time.Now()),
+			)
+
+		migrator, err := migrate.New(mock, migrations)
+		require.NoError(t, err)
+		states, err := migrator.Status(context.Background())
+		require.NoError(t, err)
+		require.Len(t, states, 3)
+		assert.False(t, states[0].Applied)
+		assert.EqualError(t, states[0].Drift, "migration 1 create_users: is pending, but migration 3 is already applied")
+		assert.True(t, states[1].Applied)
+		assert.NoError(t, states[1].Drift)
+		assert.ErrorIs(t, states[2].Drift, migrate.ErrDrift)
+		assert.EqualError(t, states[2].Drift, "migration 3 deleted: is applied, but has no file")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,79 @@
+package migrate_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/4ND3R50N/go-tools/dbutils/internal/pgtest"
+	"github.com/4ND3R50N/go-tools/dbutils/migrate"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	pgxPool *pgxpool.Pool
+)
+
+func TestMain(m *testing.M) {
+	pgtest.Main(m, &pgxPool)
+}
+
+func TestPGXMigratorUp(t *testing.T) {
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"1_create_accounts.sql": {Data: []byte("CREATE TABLE accounts (id int PRIMARY KEY);")},
+		"2_seed_accounts.sql":   {Data: []byte("INSERT INTO accounts VALUES (1); INSERT INTO accounts VALUES (2);")},
+	}
+
+	// Replicas starting at the same time apply the migrations exactly once.
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		applied []int64
+	)
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := pgxPool.Acquire(ctx)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer conn.Release()
+			migrator, err := migrate.New(conn.Conn(), fsys)
+			if !assert.NoError(t, err) {
+				return
+			}
+			migrations, err := migrator.Up(ctx)
+			assert.NoError(t, err)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, migration := range migrations {
+				applied = append(applied, migration.Version)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.ElementsMatch(t, []int64{1, 2}, applied)
+
+	var count int
+	require.NoError(t, pgxPool.QueryRow(ctx, "SELECT count(*) FROM accounts").Scan(&count))
+	assert.Equal(t, 2, count)
+
+	conn, err := pgxPool.Acquire(ctx)
+	require.NoError(t, err)
+	defer conn.Release()
+	fsys["2_seed_accounts.sql"] = &fstest.MapFile{Data: []byte("INSERT INTO accounts VALUES (3);")}
+	fsys["3_drop_accounts.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE accounts;")}
+	migrator, err := migrate.New(conn.Conn(), fsys)
+	require.NoError(t, err)
+	_, err = migrator.Plan(ctx)
+	assert.ErrorIs(t, err, migrate.ErrDrift)
+	_, err = migrator.Up(ctx)
+	assert.ErrorIs(t, err, migrate.ErrDrift)
+	require.NoError(t, pgxPool.QueryRow(ctx, "SELECT count(*) FROM accounts").Scan(&count))
+	assert.Equal(t, 2, count)
+}
@@ -0,0 +1,154 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const defaultVersionAttempts = 3
+
+var (
+	ErrStaleVersion = errors.New("row was modified concurrently")
+)
+
+// StaleVersionError is returned by UpdateVersioned if the row does not exist with the expected version anymore. It
+// matches ErrStaleVersion with errors.Is.
+type StaleVersionError struct {
+	Table   string
+	ID      any
+	Version int64
+}
+
+func (e *StaleVersionError) Error() string {
+	return fmt.Sprintf("%s: %s %v is not at version %d", ErrStaleVersion, e.Table, e.ID, e.Version)
+}
+
+func (e *StaleVersionError) Is(target error) bool {
+	return target == ErrStaleVersion
+}
+
+type VersionOptions struct {
+	idColumn      string
+	versionColumn string
+	maxAttempts   int
+	retryOptions  []func(*RetryOptions)
+	txOptions     []func(*Options)
+}
+
+// WithIDColumn this option configures the primary key column of the table. Default is "id".
+func WithIDColumn(column string) func(*VersionOptions) {
+	return func(v *VersionOptions) {
+		v.idColumn = column
+	}
+}
+
+// WithVersionColumn this option configures the version column of the table. Default is "version".
+func WithVersionColumn(column string) func(*VersionOptions) {
+	return func(v *VersionOptions) {
+		v.versionColumn = column
+	}
+}
+
+// WithVersionRetry this option configures how often UpdateVersionedRetry runs at most. Default is 3 attempts. The
+// retry options behave like the ones of WithRetry.
+func WithVersionRetry(maxAttempts int, options ...func(*RetryOptions)) func(*VersionOptions) {
+	return func(v *VersionOptions) {
+		v.maxAttempts = maxAttempts
+		v.retryOptions = options
+	}
+}
+
+// WithVersionTransactionOptions this option configures the transaction UpdateVersionedRetry runs in.
+func WithVersionTransactionOptions(options ...func(*Options)) func(*VersionOptions) {
+	return func(v *VersionOptions) {
+		v.txOptions = append(v.txOptions, options...)
+	}
+}
+
+// UpdateVersioned updates the columns in set of the row with the given id, if the row is still at version. The
+// version is incremented and returned. If the row was modified or deleted in the meantime, a StaleVersionError is
+// returned.
+func UpdateVersioned(
+	ctx context.Context,
+	db PGXInterface,
+	table string,
+	id any,
+	version int64,
+	set map[string]any,
+	options ...func(*VersionOptions),
+) (int64, error) {
+	opts := newVersionOptions(options)
+	versionColumn := pgx.Identifier{opts.versionColumn}.Sanitize()
+	assignments := []string{fmt.Sprintf("%[1]s = %[1]s + 1", versionColumn)}
+	args := []any{id, version}
+	columns := make([]string, 0, len(set))
+	for column := range set {
+		columns = append(columns, column)
+	}
+	slices.Sort(columns)
+	for _, column := range columns {
+		args = append(args, set[column])
+		assignments = append(assignments, fmt.Sprintf("%s = $%d", pgx.Identifier{column}.Sanitize(), len(args)))
+	}
+	tag, err := db.Exec(ctx, fmt.Sprintf(
+		"UPDATE %s SET %s WHERE %s = $1 AND %s = $2",
+		pgx.Identifier{table}.Sanitize(),
+		strings.Join(assignments, ", "),
+		pgx.Identifier{opts.idColumn}.Sanitize(),
+		versionColumn,
+	), args...)
+	if err != nil {
+		return 0, fmt.Errorf("could not update %s %v: %w", table, id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return 0, &StaleVersionError{Table: table, ID: id, Version: version}
+	}
+	return version + 1, nil
+}
+
+// UpdateVersionedRetry reads the row with read, applies mutate to it and stores the changed columns with
+// UpdateVersioned. If the row was modified concurrently, all of it is retried in a fresh transaction, so mutate is
+// applied to the current row. It returns the new version.
+// Like WithRetry, retrying has no effect if db is a pgx.Tx.
+func UpdateVersionedRetry[T any](
+	ctx context.Context,
+	db Beginner,
+	table string,
+	id any,
+	read func(tx pgx.Tx) (row T, version int64, err error),
+	mutate func(row T) (map[string]any, error),
+	options ...func(*VersionOptions),
+) (int64, error) {
+	opts := newVersionOptions(options)
+	retryOptions := append(slices.Clone(opts.retryOptions), func(r *RetryOptions) {
+		retryable := r.retryable
+		r.retryable = func(err error) bool {
+			return errors.Is(err, ErrStaleVersion) || (retryable != nil && retryable(err))
+		}
+	})
+	txOptions := append([]func(*Options){WithRetry(opts.maxAttempts, retryOptions...)}, opts.txOptions...)
+	return TransactionResult(ctx, db, func(tx pgx.Tx) (int64, error) {
+		row, version, err := read(tx)
+		if err != nil {
+			return 0, err
+		}
+		set, err := mutate(row)
+		if err != nil {
+			return 0, err
+		}
+		return UpdateVersioned(ctx, tx, table, id, version, set, options...)
+	}, txOptions...)
+}
+
+func newVersionOptions(options []func(*VersionOptions)) *VersionOptions {
+	opts := &VersionOptions{idColumn: "id", versionColumn: "version", maxAttempts: defaultVersionAttempts}
+	for _, o := range options {
+		o(opts)
+	}
+	return opts
+}
@@ -0,0 +1,137 @@
+package dbutils_test
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateVersioned(t *testing.T) {
+	updateSQL := regexp.QuoteMeta(
+		`UPDATE "accounts" SET "version" = "version" + 1, "balance" = $3, "status" = $4 WHERE "id" = $1 AND "version" = $2`,
+	)
+
+	t.Run("update", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectExec(updateSQL).
+			WithArgs(1, int64(4), 100, "open").
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		version, err := dbutils.UpdateVersioned(context.Background(), mock, "accounts", 1, 4, map[string]any{
+			"status":  "open",
+			"balance": 100,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), version)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("stale version", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectExec(regexp.QuoteMeta(`UPDATE "accounts" SET "rev" = "rev" + 1 WHERE "account_id" = $1 AND "rev" = $2`)).
+			WithArgs(1, int64(4)).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+		_, err = dbutils.UpdateVersioned(context.Background(), mock, "accounts", 1, 4, nil,
+			dbutils.WithIDColumn("account_id"), dbutils.WithVersionColumn("rev"))
+		assert.ErrorIs(t, err, dbutils.ErrStaleVersion)
+		var staleErr *dbutils.StaleVersionError
+		require.ErrorAs(t, err, &staleErr)
+		assert.Equal(t, int64(4), staleErr.Version)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("retry re-applies the mutation", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		for i, affected := range []int64{0, 1} {
+			mock.ExpectBegin()
+			mock.
+				ExpectExec(updateSQL).
+				WithArgs(1, int64(4+i), 100+i*10, "open").
+				WillReturnResult(pgxmock.NewResult("UPDATE", affected))
+			if affected == 0 {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectCommit()
+			}
+		}
+
+		reads := 0
+		version, err := dbutils.UpdateVersionedRetry(context.Background(), mock, "accounts", 1,
+			func(pgx.Tx) (int, int64, error) {
+				// The row was modified by someone else between the attempts.
+				balance, version := 90+reads*10, int64(4+reads)
+				reads++
+				return balance, version, nil
+			},
+			func(balance int) (map[string]any, error) {
+				return map[string]any{"balance": balance + 10, "status": "open"}, nil
+			},
+			dbutils.WithVersionRetry(2, dbutils.WithBackoff(time.Millisecond, time.Millisecond)),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, int64(6), version)
+		assert.Equal(t, 2, reads)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPGXUpdateVersioned(t *testing.T) {
+	ctx := context.Background()
+	_, err := pgxPool.Exec(ctx, `
+		CREATE TABLE versioned (id int PRIMARY KEY, counter int NOT NULL, version bigint NOT NULL);
+		INSERT INTO versioned VALUES (1, 0, 1);
+	`)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := dbutils.UpdateVersionedRetry(ctx, pgxPool, "versioned", 1,
+				func(tx pgx.Tx) (int, int64, error) {
+					var counter int
+					var version int64
+					err := tx.QueryRow(ctx, "SELECT counter, version FROM versioned WHERE id = 1").Scan(&counter, &version)
+					return counter, version, err
+				},
+				func(counter int) (map[string]any, error) {
+					return map[string]any{"counter": counter + 1}, nil
+				},
+				dbutils.WithVersionRetry(20, dbutils.WithBackoff(time.Millisecond, 10*time.Millisecond)),
+			)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	var counter int
+	var version int64
+	err = pgxPool.QueryRow(ctx, "SELECT counter, version FROM versioned WHERE id = 1").Scan(&counter, &version)
+	require.NoError(t, err)
+	assert.Equal(t, 5, counter)
+	assert.Equal(t, int64(6), version)
+}
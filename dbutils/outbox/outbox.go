@@ -0,0 +1,110 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+)
+
+// DefaultTable is the name of the outbox table if no other one is configured.
+const DefaultTable = "outbox"
+
+// Status is the delivery status of a message.
+type Status string
+
+const (
+	// StatusPending messages are waiting to be published.
+	StatusPending Status = "pending"
+	// StatusDelivered messages were published.
+	StatusDelivered Status = "delivered"
+	// StatusDead messages failed too often and are not tried again.
+	StatusDead Status = "dead"
+)
+
+// Message is a message of the outbox.
+type Message struct {
+	ID           int64
+	Topic        string
+	AggregateKey string
+	Payload      []byte
+	// Attempts counts the failed attempts to publish the message.
+	Attempts  int
+	CreatedAt time.Time
+}
+
+type EnqueueOptions struct {
+	table        string
+	aggregateKey string
+}
+
+// WithAggregateKey this option publishes the message strictly after all messages that were enqueued with the same
+// aggregate key before, e.g. the id of an order.
+func WithAggregateKey(key string) func(*EnqueueOptions) {
+	return func(e *EnqueueOptions) {
+		e.aggregateKey = key
+	}
+}
+
+// WithEnqueueTable this option inserts the message into the given table instead of DefaultTable.
+func WithEnqueueTable(table string) func(*EnqueueOptions) {
+	return func(e *EnqueueOptions) {
+		e.table = table
+	}
+}
+
+// Schema returns the DDL that creates the outbox table with the given name.
+func Schema(table string) string {
+	return fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %[1]s (
+			id bigserial PRIMARY KEY,
+			topic text NOT NULL,
+			aggregate_key text,
+			payload bytea NOT NULL,
+			status text NOT NULL DEFAULT 'pending',
+			attempts integer NOT NULL DEFAULT 0,
+			last_error text,
+			available_at timestamptz NOT NULL DEFAULT now(),
+			created_at timestamptz NOT NULL DEFAULT now(),
+			delivered_at timestamptz
+		);
+		CREATE INDEX IF NOT EXISTS %[2]s ON %[1]s (id) WHERE status = 'pending';
+		CREATE INDEX IF NOT EXISTS %[3]s ON %[1]s (aggregate_key, id) WHERE status = 'pending';
+	`,
+		pgx.Identifier{table}.Sanitize(),
+		pgx.Identifier{table + "_pending_idx"}.Sanitize(),
+		pgx.Identifier{table + "_aggregate_idx"}.Sanitize(),
+	)
+}
+
+// Enqueue inserts a message into the outbox. tx should be the transaction of the writes the message is about, e.g.
+// the one passed by dbutils.Transaction, so the message is only published if they are committed.
+func Enqueue(
+	ctx context.Context,
+	tx dbutils.PGXInterface,
+	topic string,
+	payload []byte,
+	options ...func(*EnqueueOptions),
+) error {
+	opts := &EnqueueOptions{table: DefaultTable}
+	for _, o := range options {
+		o(opts)
+	}
+	var aggregateKey *string
+	if opts.aggregateKey != "" {
+		aggregateKey = &opts.aggregateKey
+	}
+	if _, err := tx.Exec(
+		ctx,
+		"INSERT INTO "+pgx.Identifier{opts.table}.Sanitize()+" (topic, aggregate_key, payload) VALUES ($1, $2, $3)",
+		topic,
+		aggregateKey,
+		payload,
+	); err != nil {
+		return fmt.Errorf("could not enqueue outbox message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils/outbox"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnqueue(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close(context.Background())
+	mock.
+		ExpectExec(`INSERT INTO "outbox" \(topic, aggregate_key, payload\)`).
+		WithArgs("orders", (*string)(nil), []byte(`{"id":1}`)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	key := "order-1"
+	mock.
+		ExpectExec(`INSERT INTO "events" \(topic, aggregate_key, payload\)`).
+		WithArgs("orders", &key, []byte(`{"id":1}`)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	require.NoError(t, outbox.Enqueue(context.Background(), mock, "orders", []byte(`{"id":1}`)))
+	require.NoError(t, outbox.Enqueue(
+		context.Background(),
+		mock,
+		"orders",
+		[]byte(`{"id":1}`),
+		outbox.WithAggregateKey("order-1"),
+		outbox.WithEnqueueTable("events"),
+	))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelay(t *testing.T) {
+	messageRows := func(mock pgxmock.PgxConnIface) *pgxmock.Rows {
+		key := "order-1"
+		return mock.
+			NewRows([]string{"id", "topic", "aggregate_key", "payload", "attempts", "created_at"}).
+			AddRow(int64(1), "orders", &key, []byte("a"), 0, time.Now()).
+			AddRow(int64(2), "orders", (*string)(nil), []byte("b"), 2, time.Now())
+	}
+
+	t.Run("deliver and retry", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.ExpectBegin()
+		mock.
+			ExpectQuery(`SELECT .* FROM "outbox" AS o .* FOR UPDATE SKIP LOCKED`).
+			WithArgs(10).
+			WillReturnRows(messageRows(mock))
+		mock.
+			ExpectExec(`UPDATE "outbox" SET status = \$1, delivered_at = now\(\)`).
+			WithArgs("delivered", int64(1)).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.
+			ExpectExec(`UPDATE "outbox" SET status = \$1, attempts = \$2, last_error = \$3`).
+			WithArgs("pending", 3, "broker unavailable", int64(400), int64(2)).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectCommit()
+
+		var published []outbox.Message
+		relay := outbox.NewRelay(mock, outbox.PublisherFunc(func(_ context.Context, msg outbox.Message) error {
+			published = append(published, msg)
+			if msg.ID == 2 {
+				return errors.New("broker unavailable")
+			}
+			return nil
+		}), outbox.WithBatchSize(10), outbox.WithRetryBackoff(100*time.Millisecond, time.Minute))
+
+		processed, err := relay.Process(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 2, processed)
+		require.Len(t, published, 2)
+		assert.Equal(t, "order-1", published[0].AggregateKey)
+		assert.Equal(t, []byte("b"), published[1].Payload)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("dead letter", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.ExpectBegin()
+		mock.
+			ExpectQuery(`SELECT .* FROM "outbox" AS o`).
+			WithArgs(100).
+			WillReturnRows(messageRows(mock))
+		mock.
+			ExpectExec(`UPDATE "outbox" SET status = \$1, attempts = \$2`).
+			WithArgs("pending", 1, "broken", int64(1000), int64(1)).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.
+			ExpectExec(`UPDATE "outbox" SET status = \$1, attempts = \$2`).
+			WithArgs("dead", 3, "broken", int64(4000), int64(2)).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectCommit()
+
+		relay := outbox.NewRelay(mock, outbox.PublisherFunc(func(context.Context, outbox.Message) error {
+			return errors.New("broken")
+		}), outbox.WithMaxAttempts(3))
+
+		processed, err := relay.Process(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 2, processed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("roll back on failed update", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.ExpectBegin()
+		mock.
+			ExpectQuery(`SELECT .* FROM "outbox" AS o`).
+			WithArgs(100).
+			WillReturnRows(messageRows(mock))
+		mock.
+			ExpectExec(`UPDATE "outbox" SET status = \$1, delivered_at = now\(\)`).
+			WithArgs("delivered", int64(1)).
+			WillReturnError(errors.New("connection lost"))
+		mock.ExpectRollback()
+
+		relay := outbox.NewRelay(mock, outbox.PublisherFunc(func(context.Context, outbox.Message) error {
+			return nil
+		}))
+
+		_, err = relay.Process(context.Background())
+		assert.ErrorContains(t, err, "could not mark outbox message 1 as delivered")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestSchema(t *testing.T) {
+	schema := outbox.Schema("events")
+	assert.Contains(t, schema, `CREATE TABLE IF NOT EXISTS "events"`)
+	assert.Contains(t, schema, `CREATE INDEX IF NOT EXISTS "events_pending_idx" ON "events"`)
+}
@@ -0,0 +1,226 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/4ND3R50N/go-tools/dbutils/internal/retry"
+)
+
+const (
+	defaultBatchSize      = 100
+	defaultMaxAttempts    = 10
+	defaultPollInterval   = time.Second
+	defaultRetryBaseDelay = time.Second
+	defaultRetryMaxDelay  = 5 * time.Minute
+)
+
+// Publisher publishes the messages of the outbox, e.g. to a message broker.
+type Publisher interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+// PublisherFunc is a function that implements Publisher.
+type PublisherFunc func(ctx context.Context, msg Message) error
+
+func (f PublisherFunc) Publish(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+// Relay publishes the pending messages of the outbox. Several relays can run on the same table, each message is
+// claimed by one of them with FOR UPDATE SKIP LOCKED. Messages are delivered at least once, so consumers have to
+// deduplicate, e.g. by Message.ID.
+type Relay struct {
+	db             dbutils.Beginner
+	publisher      Publisher
+	table          string
+	batchSize      int
+	maxAttempts    int
+	pollInterval   time.Duration
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+	onError        func(err error)
+}
+
+// NewRelay creates a Relay that publishes the messages of db with publisher.
+func NewRelay(db dbutils.Beginner, publisher Publisher, options ...func(*Relay)) *Relay {
+	r := &Relay{
+		db:             db,
+		publisher:      publisher,
+		table:          DefaultTable,
+		batchSize:      defaultBatchSize,
+		maxAttempts:    defaultMaxAttempts,
+		pollInterval:   defaultPollInterval,
+		retryBaseDelay: defaultRetryBaseDelay,
+		retryMaxDelay:  defaultRetryMaxDelay,
+		onError:        func(error) {},
+	}
+	for _, o := range options {
+		o(r)
+	}
+	return r
+}
+
+// WithTable this option reads the messages from the given table instead of DefaultTable.
+func WithTable(table string) func(*Relay) {
+	return func(r *Relay) {
+		r.table = table
+	}
+}
+
+// WithBatchSize this option configures how many messages are claimed in one transaction.
+func WithBatchSize(batchSize int) func(*Relay) {
+	return func(r *Relay) {
+		r.batchSize = batchSize
+	}
+}
+
+// WithMaxAttempts this option configures how often publishing a message is tried before it is marked as StatusDead.
+func WithMaxAttempts(maxAttempts int) func(*Relay) {
+	return func(r *Relay) {
+		r.maxAttempts = maxAttempts
+	}
+}
+
+// WithPollInterval this option configures how long Run waits for new messages once the outbox is drained.
+func WithPollInterval(interval time.Duration) func(*Relay) {
+	return func(r *Relay) {
+		r.pollInterval = interval
+	}
+}
+
+// WithRetryBackoff this option configures the delay before a failed message is tried again. The delay starts at
+// baseDelay, doubles with each attempt and is capped at maxDelay.
+func WithRetryBackoff(baseDelay, maxDelay time.Duration) func(*Relay) {
+	return func(r *Relay) {
+		r.retryBaseDelay = baseDelay
+		r.retryMaxDelay = maxDelay
+	}
+}
+
+// WithOnError this option configures a callback for the errors Run continues after, e.g. to log them.
+func WithOnError(onError func(err error)) func(*Relay) {
+	return func(r *Relay) {
+		r.onError = onError
+	}
+}
+
+// Run publishes messages until ctx is cancelled. It returns ctx.Err().
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		processed, err := r.Process(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			r.onError(err)
+		}
+		if err == nil && processed == r.batchSize {
+			continue
+		}
+		timer := time.NewTimer(r.pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Process claims a batch of pending messages and publishes them in a single transaction. Failed messages are scheduled
+// for a retry or marked as StatusDead. Of each aggregate key, only the oldest pending message is claimed, so they are
+// published in order. Process returns the number of claimed messages.
+func (r *Relay) Process(ctx context.Context) (int, error) {
+	return dbutils.TransactionResult(ctx, r.db, func(tx pgx.Tx) (int, error) {
+		messages, err := r.claim(ctx, tx)
+		if err != nil {
+			return 0, err
+		}
+		for _, msg := range messages {
+			publishErr := r.publisher.Publish(ctx, msg)
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+			if publishErr != nil {
+				err = r.fail(ctx, tx, msg, publishErr)
+			} else {
+				err = r.deliver(ctx, tx, msg)
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+		return len(messages), nil
+	})
+}
+
+func (r *Relay) claim(ctx context.Context, tx pgx.Tx) ([]Message, error) {
+	rows, err := tx.Query(ctx, fmt.Sprintf(`
+		SELECT id, topic, aggregate_key, payload, attempts, created_at FROM %[1]s AS o
+		WHERE status = 'pending' AND available_at <= now() AND (
+			aggregate_key IS NULL OR NOT EXISTS (
+				SELECT 1 FROM %[1]s AS p WHERE p.aggregate_key = o.aggregate_key AND p.status = 'pending' AND p.id < o.id
+			)
+		)
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, pgx.Identifier{r.table}.Sanitize()), r.batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("could not claim outbox messages: %w", err)
+	}
+	messages, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Message, error) {
+		var (
+			msg          Message
+			aggregateKey *string
+		)
+		err := row.Scan(&msg.ID, &msg.Topic, &aggregateKey, &msg.Payload, &msg.Attempts, &msg.CreatedAt)
+		if aggregateKey != nil {
+			msg.AggregateKey = *aggregateKey
+		}
+		return msg, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not claim outbox messages: %w", err)
+	}
+	return messages, nil
+}
+
+func (r *Relay) deliver(ctx context.Context, tx pgx.Tx, msg Message) error {
+	if _, err := tx.Exec(
+		ctx,
+		"UPDATE "+pgx.Identifier{r.table}.Sanitize()+" SET status = $1, delivered_at = now() WHERE id = $2",
+		string(StatusDelivered),
+		msg.ID,
+	); err != nil {
+		return fmt.Errorf("could not mark outbox message %d as delivered: %w", msg.ID, err)
+	}
+	return nil
+}
+
+func (r *Relay) fail(ctx context.Context, tx pgx.Tx, msg Message, publishErr error) error {
+	attempts := msg.Attempts + 1
+	status := StatusPending
+	if attempts >= r.maxAttempts {
+		status = StatusDead
+	}
+	if _, err := tx.Exec(
+		ctx,
+		"UPDATE "+pgx.Identifier{r.table}.Sanitize()+
+			" SET status = $1, attempts = $2, last_error = $3, available_at = now() + $4 * interval '1 millisecond'"+
+			" WHERE id = $5",
+		string(status),
+		attempts,
+		retry.ErrorMessage(publishErr),
+		retry.Delay(attempts, r.retryBaseDelay, r.retryMaxDelay).Milliseconds(),
+		msg.ID,
+	); err != nil {
+		return fmt.Errorf("could not mark outbox message %d as failed: %w", msg.ID, err)
+	}
+	return nil
+}
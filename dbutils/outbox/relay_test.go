@@ -0,0 +1,135 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/4ND3R50N/go-tools/dbutils/internal/pgtest"
+	"github.com/4ND3R50N/go-tools/dbutils/outbox"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	pgxPool *pgxpool.Pool
+)
+
+func TestMain(m *testing.M) {
+	pgtest.Main(m, &pgxPool)
+}
+
+func TestPGXRelay(t *testing.T) {
+	ctx := context.Background()
+	const (
+		table      = "outbox_relay"
+		aggregates = 3
+		perKey     = 10
+	)
+	_, err := pgxPool.Exec(ctx, outbox.Schema(table))
+	require.NoError(t, err)
+
+	// The first message of "order-poison" can never be published, the one after it is published once it is dead.
+	require.NoError(t, dbutils.Transaction(ctx, pgxPool, func(tx pgx.Tx) error {
+		for i := range perKey {
+			for a := range aggregates {
+				key := "order-" + strconv.Itoa(a)
+				err := outbox.Enqueue(ctx, tx, "orders", []byte(strconv.Itoa(i)), outbox.WithAggregateKey(key),
+					outbox.WithEnqueueTable(table))
+				if err != nil {
+					return err
+				}
+			}
+			if err := outbox.Enqueue(ctx, tx, "audit", []byte("{}"), outbox.WithEnqueueTable(table)); err != nil {
+				return err
+			}
+		}
+		for _, topic := range []string{"poison", "orders"} {
+			err := outbox.Enqueue(ctx, tx, topic, []byte("0"), outbox.WithAggregateKey("order-poison"),
+				outbox.WithEnqueueTable(table))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	var (
+		mu        sync.Mutex
+		published = make(map[string][]string)
+		audits    int
+	)
+	publisher := outbox.PublisherFunc(func(_ context.Context, msg outbox.Message) error {
+		if msg.Topic == "poison" {
+			return errors.New("broker down")
+		}
+		// Give the other relay the chance to interleave.
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		if msg.AggregateKey == "" {
+			audits++
+			return nil
+		}
+		published[msg.AggregateKey] = append(published[msg.AggregateKey], string(msg.Payload))
+		return nil
+	})
+
+	runCtx, cancel := context.WithCancel(ctx)
+	results := make(chan error, 2)
+	for range 2 {
+		relay := outbox.NewRelay(
+			pgxPool,
+			publisher,
+			outbox.WithTable(table),
+			outbox.WithBatchSize(2),
+			outbox.WithMaxAttempts(3),
+			outbox.WithPollInterval(10*time.Millisecond),
+			outbox.WithRetryBackoff(time.Millisecond, time.Millisecond),
+		)
+		go func() {
+			results <- relay.Run(runCtx)
+		}()
+	}
+	require.Eventually(t, func() bool {
+		var pending int
+		err := pgxPool.QueryRow(ctx, "SELECT count(*) FROM "+table+" WHERE status = 'pending'").Scan(&pending)
+		return err == nil && pending == 0
+	}, 10*time.Second, 10*time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-results, context.Canceled)
+	assert.ErrorIs(t, <-results, context.Canceled)
+
+	// Each message was published exactly once and in order of its aggregate.
+	var expected []string
+	for i := range perKey {
+		expected = append(expected, strconv.Itoa(i))
+	}
+	for a := range aggregates {
+		assert.Equal(t, expected, published["order-"+strconv.Itoa(a)])
+	}
+	assert.Equal(t, perKey, audits)
+	assert.Equal(t, []string{"0"}, published["order-poison"])
+
+	var (
+		status    outbox.Status
+		attempts  int
+		lastError string
+	)
+	err = pgxPool.QueryRow(ctx, "SELECT status, attempts, last_error FROM "+table+" WHERE topic = 'poison'").
+		Scan(&status, &attempts, &lastError)
+	require.NoError(t, err)
+	assert.Equal(t, outbox.StatusDead, status)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, "broker down", lastError)
+	var delivered int
+	err = pgxPool.QueryRow(ctx, "SELECT count(*) FROM "+table+" WHERE status = 'delivered'").Scan(&delivered)
+	require.NoError(t, err)
+	assert.Equal(t, aggregates*perKey+perKey+1, delivered)
+}
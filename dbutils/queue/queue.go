@@ -0,0 +1,151 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+)
+
+// DefaultTable is the name of the job table if no other one is configured.
+const DefaultTable = "jobs"
+
+var (
+	ErrDuplicateJob = errors.New("job with the same dedup key is queued already")
+)
+
+// Status is the processing status of a job.
+type Status string
+
+const (
+	// StatusPending jobs are waiting to be run.
+	StatusPending Status = "pending"
+	// StatusRunning jobs are run by a worker right now. If the worker does not finish them within the visibility
+	// timeout, they are run again.
+	StatusRunning Status = "running"
+	// StatusDone jobs were run successfully.
+	StatusDone Status = "done"
+	// StatusFailed jobs failed too often and are not run again.
+	StatusFailed Status = "failed"
+)
+
+// Job is a job of the queue.
+type Job struct {
+	ID       int64
+	Kind     string
+	Payload  []byte
+	Priority int
+	DedupKey string
+	// Attempt is the number of the current attempt, starting at 1.
+	Attempt   int
+	RunAt     time.Time
+	CreatedAt time.Time
+}
+
+type EnqueueOptions struct {
+	table    string
+	runAt    time.Time
+	priority int
+	dedupKey string
+}
+
+// WithRunAt this option runs the job not before runAt.
+func WithRunAt(runAt time.Time) func(*EnqueueOptions) {
+	return func(e *EnqueueOptions) {
+		e.runAt = runAt
+	}
+}
+
+// WithPriority this option runs the job before all jobs with a lower priority. Default is 0.
+func WithPriority(priority int) func(*EnqueueOptions) {
+	return func(e *EnqueueOptions) {
+		e.priority = priority
+	}
+}
+
+// WithDedupKey this option only enqueues the job if no other pending or running job has the same dedup key. Otherwise
+// Enqueue returns ErrDuplicateJob.
+func WithDedupKey(key string) func(*EnqueueOptions) {
+	return func(e *EnqueueOptions) {
+		e.dedupKey = key
+	}
+}
+
+// WithEnqueueTable this option inserts the job into the given table instead of DefaultTable.
+func WithEnqueueTable(table string) func(*EnqueueOptions) {
+	return func(e *EnqueueOptions) {
+		e.table = table
+	}
+}
+
+// Schema returns the DDL that creates the job table with the given name.
+func Schema(table string) string {
+	return fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %[1]s (
+			id bigserial PRIMARY KEY,
+			kind text NOT NULL,
+			payload bytea NOT NULL,
+			priority integer NOT NULL DEFAULT 0,
+			dedup_key text,
+			status text NOT NULL DEFAULT 'pending',
+			attempts integer NOT NULL DEFAULT 0,
+			last_error text,
+			run_at timestamptz NOT NULL DEFAULT now(),
+			locked_until timestamptz,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			finished_at timestamptz
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS %[2]s ON %[1]s (dedup_key) WHERE status IN ('pending', 'running');
+		CREATE INDEX IF NOT EXISTS %[3]s ON %[1]s (priority DESC, run_at, id) WHERE status IN ('pending', 'running');
+	`,
+		pgx.Identifier{table}.Sanitize(),
+		pgx.Identifier{table + "_dedup_idx"}.Sanitize(),
+		pgx.Identifier{table + "_queued_idx"}.Sanitize(),
+	)
+}
+
+// Enqueue inserts a job of the given kind and returns its id. If db is a transaction, the job is only run if the
+// transaction is committed.
+func Enqueue(
+	ctx context.Context,
+	db dbutils.PGXRowInterface,
+	kind string,
+	payload []byte,
+	options ...func(*EnqueueOptions),
+) (int64, error) {
+	opts := &EnqueueOptions{table: DefaultTable}
+	for _, o := range options {
+		o(opts)
+	}
+	var (
+		runAt    *time.Time
+		dedupKey *string
+	)
+	if !opts.runAt.IsZero() {
+		runAt = &opts.runAt
+	}
+	if opts.dedupKey != "" {
+		dedupKey = &opts.dedupKey
+	}
+	if payload == nil {
+		payload = []byte{}
+	}
+	var id int64
+	err := db.QueryRow(ctx, `
+		INSERT INTO `+pgx.Identifier{opts.table}.Sanitize()+` (kind, payload, priority, dedup_key, run_at)
+		VALUES ($1, $2, $3, $4, coalesce($5, now()))
+		ON CONFLICT (dedup_key) WHERE status IN ('pending', 'running') DO NOTHING
+		RETURNING id
+	`, kind, payload, opts.priority, dedupKey, runAt).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("%w: %s", ErrDuplicateJob, opts.dedupKey)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not enqueue job: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,203 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils/queue"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnqueue(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close(context.Background())
+	runAt := time.Now().Add(time.Hour)
+	dedupKey := "report-1"
+	mock.
+		ExpectQuery(`INSERT INTO "jobs" \(kind, payload, priority, dedup_key, run_at\)`).
+		WithArgs("report", []byte{}, 5, &dedupKey, &runAt).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(int64(1)))
+	mock.
+		ExpectQuery(`INSERT INTO "jobs"`).
+		WithArgs("report", []byte{}, 0, &dedupKey, (*time.Time)(nil)).
+		WillReturnError(pgx.ErrNoRows)
+
+	id, err := queue.Enqueue(
+		context.Background(),
+		mock,
+		"report",
+		nil,
+		queue.WithPriority(5),
+		queue.WithRunAt(runAt),
+		queue.WithDedupKey("report-1"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), id)
+
+	_, err = queue.Enqueue(context.Background(), mock, "report", nil, queue.WithDedupKey("report-1"))
+	assert.ErrorIs(t, err, queue.ErrDuplicateJob)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkerPool(t *testing.T) {
+	jobRows := func(mock pgxmock.PgxConnIface, attempt int) *pgxmock.Rows {
+		return mock.
+			NewRows([]string{"id", "kind", "payload", "priority", "dedup_key", "attempts", "run_at", "created_at"}).
+			AddRow(int64(1), "mail", []byte("a"), 0, (*string)(nil), attempt, time.Now(), time.Now())
+	}
+
+	t.Run("no job", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.ExpectBegin()
+		mock.ExpectQuery("FOR UPDATE SKIP LOCKED").WithArgs(int64(300000)).WillReturnError(pgx.ErrNoRows)
+		mock.ExpectCommit()
+
+		pool := queue.NewWorkerPool(mock, func(context.Context, queue.Job) error {
+			t.Fatal("handler must not run")
+			return nil
+		})
+		processed, err := pool.ProcessNext(context.Background())
+		require.NoError(t, err)
+		assert.False(t, processed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("panicking job is retried", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.ExpectBegin()
+		mock.ExpectQuery("FOR UPDATE SKIP LOCKED").WithArgs(int64(1000)).WillReturnRows(jobRows(mock, 2))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.
+			ExpectExec(`UPDATE "jobs" SET status = \$1, last_error = \$2`).
+			WithArgs("pending", "job panicked: boom", int64(200), false, int64(1), 2).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectCommit()
+
+		pool := queue.NewWorkerPool(mock, func(context.Context, queue.Job) error {
+			panic("boom")
+		}, queue.WithVisibilityTimeout(time.Second), queue.WithRetryBackoff(100*time.Millisecond, time.Minute))
+		processed, err := pool.ProcessNext(context.Background())
+		require.NoError(t, err)
+		assert.True(t, processed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("cancel job on shutdown", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.ExpectBegin()
+		mock.ExpectQuery("FOR UPDATE SKIP LOCKED").WithArgs(int64(300000)).WillReturnRows(jobRows(mock, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.
+			ExpectExec(`UPDATE "jobs" SET status = \$1, last_error = \$2`).
+			WithArgs("pending", "context canceled", int64(1000), false, int64(1), 1).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectCommit()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		pool := queue.NewWorkerPool(mock, func(jobCtx context.Context, _ queue.Job) error {
+			cancel()
+			<-jobCtx.Done()
+			return jobCtx.Err()
+		})
+		processed, err := pool.ProcessNext(ctx)
+		require.NoError(t, err)
+		assert.True(t, processed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("finish job within grace period", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.ExpectBegin()
+		mock.ExpectQuery("FOR UPDATE SKIP LOCKED").WithArgs(int64(300000)).WillReturnRows(jobRows(mock, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.
+			ExpectExec(`UPDATE "jobs" SET status = \$1, locked_until = NULL`).
+			WithArgs("done", int64(1), 1).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectCommit()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		pool := queue.NewWorkerPool(mock, func(jobCtx context.Context, _ queue.Job) error {
+			cancel()
+			select {
+			case <-jobCtx.Done():
+				return jobCtx.Err()
+			case <-time.After(10 * time.Millisecond):
+				return nil
+			}
+		}, queue.WithShutdownGracePeriod(time.Hour))
+		processed, err := pool.ProcessNext(ctx)
+		require.NoError(t, err)
+		assert.True(t, processed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("fail after visibility timeout exceeded too often", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.ExpectBegin()
+		mock.ExpectQuery("FOR UPDATE SKIP LOCKED").WithArgs(int64(300000)).WillReturnRows(jobRows(mock, 4))
+		mock.
+			ExpectExec(`UPDATE "jobs" SET status = \$1, last_error = \$2`).
+			WithArgs("failed", "visibility timeout exceeded", int64(8000), true, int64(1), 4).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectCommit()
+
+		pool := queue.NewWorkerPool(mock, func(context.Context, queue.Job) error {
+			t.Fatal("handler must not run")
+			return nil
+		}, queue.WithMaxAttempts(3))
+		processed, err := pool.ProcessNext(context.Background())
+		require.NoError(t, err)
+		assert.True(t, processed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("claim error", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.ExpectBegin()
+		mock.ExpectQuery("FOR UPDATE SKIP LOCKED").WithArgs(int64(300000)).WillReturnError(errors.New("connection lost"))
+		mock.ExpectRollback()
+
+		pool := queue.NewWorkerPool(mock, func(context.Context, queue.Job) error {
+			return nil
+		})
+		_, err = pool.ProcessNext(context.Background())
+		assert.ErrorContains(t, err, "could not claim job")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
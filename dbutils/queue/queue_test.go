@@ -0,0 +1,172 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils/internal/pgtest"
+	"github.com/4ND3R50N/go-tools/dbutils/queue"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	pgxPool *pgxpool.Pool
+)
+
+func TestMain(m *testing.M) {
+	pgtest.Main(m, &pgxPool)
+}
+
+// createTable creates a fresh job table for the test.
+func createTable(t *testing.T, table string) {
+	_, err := pgxPool.Exec(context.Background(), queue.Schema(table))
+	require.NoError(t, err)
+}
+
+func jobStatus(t *testing.T, table string, id int64) (queue.Status, int) {
+	var (
+		status   queue.Status
+		attempts int
+	)
+	err := pgxPool.QueryRow(
+		context.Background(),
+		"SELECT status, attempts FROM "+table+" WHERE id = $1",
+		id,
+	).Scan(&status, &attempts)
+	require.NoError(t, err)
+	return status, attempts
+}
+
+func TestPGXQueue(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("priority and run at", func(t *testing.T) {
+		createTable(t, "jobs_order")
+		later, err := queue.Enqueue(ctx, pgxPool, "mail", []byte("later"),
+			queue.WithEnqueueTable("jobs_order"), queue.WithRunAt(time.Now().Add(time.Hour)))
+		require.NoError(t, err)
+		low, err := queue.Enqueue(ctx, pgxPool, "mail", []byte("low"), queue.WithEnqueueTable("jobs_order"))
+		require.NoError(t, err)
+		high, err := queue.Enqueue(ctx, pgxPool, "mail", []byte("high"),
+			queue.WithEnqueueTable("jobs_order"), queue.WithPriority(10))
+		require.NoError(t, err)
+
+		var ran []int64
+		pool := queue.NewWorkerPool(pgxPool, func(_ context.Context, job queue.Job) error {
+			ran = append(ran, job.ID)
+			return nil
+		}, queue.WithTable("jobs_order"))
+		for {
+			processed, err := pool.ProcessNext(ctx)
+			require.NoError(t, err)
+			if !processed {
+				break
+			}
+		}
+		assert.Equal(t, []int64{high, low}, ran)
+		status, _ := jobStatus(t, "jobs_order", later)
+		assert.Equal(t, queue.StatusPending, status)
+		status, attempts := jobStatus(t, "jobs_order", high)
+		assert.Equal(t, queue.StatusDone, status)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("dedup key", func(t *testing.T) {
+		createTable(t, "jobs_dedup")
+		_, err := queue.Enqueue(ctx, pgxPool, "report", nil,
+			queue.WithEnqueueTable("jobs_dedup"), queue.WithDedupKey("report-1"))
+		require.NoError(t, err)
+		_, err = queue.Enqueue(ctx, pgxPool, "report", nil,
+			queue.WithEnqueueTable("jobs_dedup"), queue.WithDedupKey("report-1"))
+		assert.ErrorIs(t, err, queue.ErrDuplicateJob)
+
+		pool := queue.NewWorkerPool(pgxPool, func(context.Context, queue.Job) error {
+			return nil
+		}, queue.WithTable("jobs_dedup"))
+		processed, err := pool.ProcessNext(ctx)
+		require.NoError(t, err)
+		assert.True(t, processed)
+		// Finished jobs do not block new ones.
+		_, err = queue.Enqueue(ctx, pgxPool, "report", nil,
+			queue.WithEnqueueTable("jobs_dedup"), queue.WithDedupKey("report-1"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("retry and fail", func(t *testing.T) {
+		createTable(t, "jobs_retry")
+		id, err := queue.Enqueue(ctx, pgxPool, "flaky", nil, queue.WithEnqueueTable("jobs_retry"))
+		require.NoError(t, err)
+
+		pool := queue.NewWorkerPool(pgxPool, func(context.Context, queue.Job) error {
+			return errors.New("flaky")
+		}, queue.WithTable("jobs_retry"), queue.WithMaxAttempts(2), queue.WithRetryBackoff(0, 0))
+		for range 2 {
+			processed, err := pool.ProcessNext(ctx)
+			require.NoError(t, err)
+			assert.True(t, processed)
+		}
+		processed, err := pool.ProcessNext(ctx)
+		require.NoError(t, err)
+		assert.False(t, processed)
+		status, attempts := jobStatus(t, "jobs_retry", id)
+		assert.Equal(t, queue.StatusFailed, status)
+		assert.Equal(t, 2, attempts)
+	})
+
+	t.Run("visibility timeout", func(t *testing.T) {
+		createTable(t, "jobs_visibility")
+		id, err := queue.Enqueue(ctx, pgxPool, "slow", nil, queue.WithEnqueueTable("jobs_visibility"))
+		require.NoError(t, err)
+		// Simulate a worker that crashed while running the job.
+		_, err = pgxPool.Exec(ctx,
+			"UPDATE jobs_visibility SET status = 'running', attempts = 1, locked_until = now() WHERE id = $1", id)
+		require.NoError(t, err)
+
+		var attempt int
+		pool := queue.NewWorkerPool(pgxPool, func(_ context.Context, job queue.Job) error {
+			attempt = job.Attempt
+			return nil
+		}, queue.WithTable("jobs_visibility"))
+		processed, err := pool.ProcessNext(ctx)
+		require.NoError(t, err)
+		assert.True(t, processed)
+		assert.Equal(t, 2, attempt)
+	})
+
+	t.Run("worker pool", func(t *testing.T) {
+		createTable(t, "jobs_pool")
+		for range 20 {
+			_, err := queue.Enqueue(ctx, pgxPool, "count", nil, queue.WithEnqueueTable("jobs_pool"))
+			require.NoError(t, err)
+		}
+
+		var (
+			mu   sync.Mutex
+			seen = make(map[int64]int)
+		)
+		runCtx, cancel := context.WithCancel(ctx)
+		pool := queue.NewWorkerPool(pgxPool, func(_ context.Context, job queue.Job) error {
+			mu.Lock()
+			defer mu.Unlock()
+			seen[job.ID]++
+			if len(seen) == 20 {
+				cancel()
+			}
+			return nil
+		}, queue.WithTable("jobs_pool"), queue.WithConcurrency(4), queue.WithPollInterval(10*time.Millisecond))
+
+		assert.ErrorIs(t, pool.Run(runCtx), context.Canceled)
+		assert.Len(t, seen, 20)
+		for id, count := range seen {
+			assert.Equal(t, 1, count, "job %d ran more than once", id)
+		}
+		var done int
+		require.NoError(t, pgxPool.QueryRow(ctx, "SELECT count(*) FROM jobs_pool WHERE status = 'done'").Scan(&done))
+		assert.Equal(t, 20, done)
+	})
+}
@@ -0,0 +1,279 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/4ND3R50N/go-tools/dbutils/internal/retry"
+)
+
+const (
+	defaultConcurrency       = 1
+	defaultVisibilityTimeout = 5 * time.Minute
+	defaultPollInterval      = time.Second
+	defaultMaxAttempts       = 10
+	defaultRetryBaseDelay    = time.Second
+	defaultRetryMaxDelay     = time.Hour
+)
+
+// Handler runs a job. If it returns an error or panics, the job is retried with backoff.
+type Handler func(ctx context.Context, job Job) error
+
+// WorkerPool runs the jobs of the queue with a fixed number of workers. Several pools can work on the same table, each
+// job is claimed by one worker with FOR UPDATE SKIP LOCKED.
+type WorkerPool struct {
+	db                dbutils.Beginner
+	handler           Handler
+	table             string
+	concurrency       int
+	visibilityTimeout time.Duration
+	pollInterval      time.Duration
+	maxAttempts       int
+	retryBaseDelay    time.Duration
+	retryMaxDelay     time.Duration
+	gracePeriod       time.Duration
+	onError           func(err error)
+}
+
+// NewWorkerPool creates a WorkerPool that runs the jobs of db with handler.
+func NewWorkerPool(db dbutils.Beginner, handler Handler, options ...func(*WorkerPool)) *WorkerPool {
+	p := &WorkerPool{
+		db:                db,
+		handler:           handler,
+		table:             DefaultTable,
+		concurrency:       defaultConcurrency,
+		visibilityTimeout: defaultVisibilityTimeout,
+		pollInterval:      defaultPollInterval,
+		maxAttempts:       defaultMaxAttempts,
+		retryBaseDelay:    defaultRetryBaseDelay,
+		retryMaxDelay:     defaultRetryMaxDelay,
+		onError:           func(error) {},
+	}
+	for _, o := range options {
+		o(p)
+	}
+	return p
+}
+
+// WithTable this option reads the jobs from the given table instead of DefaultTable.
+func WithTable(table string) func(*WorkerPool) {
+	return func(p *WorkerPool) {
+		p.table = table
+	}
+}
+
+// WithConcurrency this option configures how many jobs are run at the same time.
+func WithConcurrency(concurrency int) func(*WorkerPool) {
+	return func(p *WorkerPool) {
+		p.concurrency = concurrency
+	}
+}
+
+// WithVisibilityTimeout this option configures how long a job may run. The context of the handler is cancelled after
+// it, and the job is claimed again by the next worker, e.g. if the worker crashed.
+func WithVisibilityTimeout(timeout time.Duration) func(*WorkerPool) {
+	return func(p *WorkerPool) {
+		p.visibilityTimeout = timeout
+	}
+}
+
+// WithPollInterval this option configures how long a worker waits for new jobs once the queue is drained.
+func WithPollInterval(interval time.Duration) func(*WorkerPool) {
+	return func(p *WorkerPool) {
+		p.pollInterval = interval
+	}
+}
+
+// WithMaxAttempts this option configures how often a job is run before it is marked as StatusFailed.
+func WithMaxAttempts(maxAttempts int) func(*WorkerPool) {
+	return func(p *WorkerPool) {
+		p.maxAttempts = maxAttempts
+	}
+}
+
+// WithRetryBackoff this option configures the delay before a failed job is run again. The delay starts at baseDelay,
+// doubles with each attempt and is capped at maxDelay.
+func WithRetryBackoff(baseDelay, maxDelay time.Duration) func(*WorkerPool) {
+	return func(p *WorkerPool) {
+		p.retryBaseDelay = baseDelay
+		p.retryMaxDelay = maxDelay
+	}
+}
+
+// WithShutdownGracePeriod this option configures how long running jobs may continue once the context of Run or
+// ProcessNext is cancelled, before the context of their handler is cancelled as well. Default is 0.
+func WithShutdownGracePeriod(gracePeriod time.Duration) func(*WorkerPool) {
+	return func(p *WorkerPool) {
+		p.gracePeriod = gracePeriod
+	}
+}
+
+// WithOnError this option configures a callback for the errors the workers continue after, e.g. to log them.
+func WithOnError(onError func(err error)) func(*WorkerPool) {
+	return func(p *WorkerPool) {
+		p.onError = onError
+	}
+}
+
+// Run runs jobs until ctx is cancelled. On cancellation, no new jobs are claimed and the context of the running jobs is
+// cancelled after the shutdown grace period, see WithShutdownGracePeriod. Run returns ctx.Err() once they returned.
+// Jobs that fail because of the cancellation are retried like any other failed job.
+func (p *WorkerPool) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for range p.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work(ctx)
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// ProcessNext claims the next due job and runs it. It reports whether there was a job.
+func (p *WorkerPool) ProcessNext(ctx context.Context) (bool, error) {
+	job, claimed, err := p.claim(ctx)
+	if err != nil || job == nil {
+		return claimed, err
+	}
+	// The job may finish within the grace period if ctx is cancelled meanwhile, it is bounded by the visibility timeout
+	// anyway.
+	jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), p.visibilityTimeout)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.NewTimer(p.gracePeriod)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancel()
+		case <-jobCtx.Done():
+		}
+	})
+	defer stop()
+	jobErr := p.handle(jobCtx, *job)
+	finishCtx := context.WithoutCancel(ctx)
+	return true, dbutils.Transaction(finishCtx, p.db, func(tx pgx.Tx) error {
+		return p.finish(finishCtx, tx, *job, jobErr)
+	})
+}
+
+func (p *WorkerPool) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		processed, err := p.ProcessNext(ctx)
+		if err != nil && ctx.Err() == nil {
+			p.onError(err)
+		}
+		if processed && err == nil {
+			continue
+		}
+		timer := time.NewTimer(p.pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// claim marks the next due job as running. Jobs that are running for longer than the visibility timeout are due
+// again. Jobs that used up their attempts that way are marked as failed instead, claim reports them as claimed but
+// returns no job.
+func (p *WorkerPool) claim(ctx context.Context) (*Job, bool, error) {
+	table := pgx.Identifier{p.table}.Sanitize()
+	var claimed bool
+	job, err := dbutils.TransactionResult(ctx, p.db, func(tx pgx.Tx) (*Job, error) {
+		var (
+			job      Job
+			dedupKey *string
+		)
+		err := tx.QueryRow(ctx, `
+			WITH next AS (
+				SELECT id FROM `+table+`
+				WHERE (status = 'pending' AND run_at <= now()) OR (status = 'running' AND locked_until <= now())
+				ORDER BY priority DESC, run_at, id
+				LIMIT 1
+				FOR UPDATE SKIP LOCKED
+			)
+			UPDATE `+table+` AS j
+			SET status = 'running', attempts = j.attempts + 1, locked_until = now() + $1 * interval '1 millisecond'
+			FROM next WHERE j.id = next.id
+			RETURNING j.id, j.kind, j.payload, j.priority, j.dedup_key, j.attempts, j.run_at, j.created_at
+		`, p.visibilityTimeout.Milliseconds()).Scan(
+			&job.ID, &job.Kind, &job.Payload, &job.Priority, &dedupKey, &job.Attempt, &job.RunAt, &job.CreatedAt,
+		)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not claim job: %w", err)
+		}
+		claimed = true
+		if dedupKey != nil {
+			job.DedupKey = *dedupKey
+		}
+		if job.Attempt > p.maxAttempts {
+			return nil, p.finish(ctx, tx, job, errors.New("visibility timeout exceeded"))
+		}
+		return &job, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return job, claimed, nil
+}
+
+// handle runs the handler and turns panics into errors.
+func (p *WorkerPool) handle(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return p.handler(ctx, job)
+}
+
+// finish stores the result of the job. A failed job is scheduled for a retry or marked as failed once it used up its
+// attempts. finish has no effect if the job was claimed by another worker meanwhile, because its visibility timeout
+// was exceeded.
+func (p *WorkerPool) finish(ctx context.Context, tx pgx.Tx, job Job, jobErr error) error {
+	table := pgx.Identifier{p.table}.Sanitize()
+	if jobErr == nil {
+		if _, err := tx.Exec(
+			ctx,
+			"UPDATE "+table+" SET status = $1, locked_until = NULL, finished_at = now()"+
+				" WHERE id = $2 AND attempts = $3 AND status = 'running'",
+			string(StatusDone),
+			job.ID,
+			job.Attempt,
+		); err != nil {
+			return fmt.Errorf("could not mark job %d as done: %w", job.ID, err)
+		}
+		return nil
+	}
+	status := StatusPending
+	if job.Attempt >= p.maxAttempts {
+		status = StatusFailed
+	}
+	if _, err := tx.Exec(
+		ctx,
+		"UPDATE "+table+" SET status = $1, last_error = $2, locked_until = NULL,"+
+			" run_at = now() + $3 * interval '1 millisecond', finished_at = CASE WHEN $4 THEN now() END"+
+			" WHERE id = $5 AND attempts = $6 AND status = 'running'",
+		string(status),
+		retry.ErrorMessage(jobErr),
+		retry.Delay(job.Attempt, p.retryBaseDelay, p.retryMaxDelay).Milliseconds(),
+		status == StatusFailed,
+		job.ID,
+		job.Attempt,
+	); err != nil {
+		return fmt.Errorf("could not mark job %d as failed: %w", job.ID, err)
+	}
+	return nil
+}
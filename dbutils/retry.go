@@ -0,0 +1,112 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils/internal/retry"
+)
+
+const (
+	defaultRetryBaseDelay = 10 * time.Millisecond
+	defaultRetryMaxDelay  = time.Second
+)
+
+// RetryError is returned by Transaction if it was configured with WithRetry and did not succeed. It wraps the error of
+// the last attempt.
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("transaction failed after %d attempts: %s", e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+type RetryOptions struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	retryable   func(err error) bool
+}
+
+// WithRetry this option re-runs the whole transaction in a fresh transaction if it failed with a serialization failure
+// (SQLSTATE 40001) or a deadlock (SQLSTATE 40P01). The transaction runs maxAttempts times at most.
+// Retrying has no effect if Transaction is called with a pgx.Tx, because the outer transaction is aborted anyway.
+func WithRetry(maxAttempts int, options ...func(*RetryOptions)) func(*Options) {
+	return func(t *Options) {
+		t.retry = &RetryOptions{
+			maxAttempts: maxAttempts,
+			baseDelay:   defaultRetryBaseDelay,
+			maxDelay:    defaultRetryMaxDelay,
+		}
+		for _, o := range options {
+			o(t.retry)
+		}
+	}
+}
+
+// WithBackoff this option configures the exponential backoff between two attempts. The delay starts at baseDelay,
+// doubles with each attempt and is capped at maxDelay. A random jitter of up to half of the delay is subtracted.
+func WithBackoff(baseDelay, maxDelay time.Duration) func(*RetryOptions) {
+	return func(r *RetryOptions) {
+		r.baseDelay = baseDelay
+		r.maxDelay = maxDelay
+	}
+}
+
+// WithRetryClassifier this option marks additional errors as retryable, e.g. other SQLSTATE codes.
+func WithRetryClassifier(retryable func(err error) bool) func(*RetryOptions) {
+	return func(r *RetryOptions) {
+		r.retryable = retryable
+	}
+}
+
+// run calls fn until it succeeds, fails with an error that is not retryable or the attempts are used up.
+func (r *RetryOptions) run(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if !r.isRetryable(err) {
+			if attempt == 1 {
+				return err
+			}
+			return &RetryError{Attempts: attempt, Err: err}
+		}
+		if attempt >= r.maxAttempts {
+			return &RetryError{Attempts: attempt, Err: err}
+		}
+		timer := time.NewTimer(r.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &RetryError{Attempts: attempt, Err: errors.Join(err, ctx.Err())}
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *RetryOptions) isRetryable(err error) bool {
+	if errors.Is(err, ErrSerializationFailure) || errors.Is(err, ErrDeadlock) {
+		return true
+	}
+	return r.retryable != nil && r.retryable(err)
+}
+
+// backoff returns the delay after the given attempt.
+func (r *RetryOptions) backoff(attempt int) time.Duration {
+	delay := retry.Delay(attempt, r.baseDelay, r.maxDelay)
+	if delay <= 0 {
+		return 0
+	}
+	return delay - rand.N(delay/2+1)
+}
@@ -0,0 +1,131 @@
+package dbutils_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRetry(t *testing.T) {
+	serializationFailure := &pgconn.PgError{Code: "40001"}
+
+	t.Run("retry serialization failure", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectCommit().WillReturnError(serializationFailure)
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		attempts := 0
+		require.NoError(t, dbutils.Transaction(context.Background(), mock, func(_ pgx.Tx) error {
+			attempts++
+			return nil
+		}, dbutils.WithRetry(3, dbutils.WithBackoff(time.Millisecond, time.Millisecond))))
+		assert.Equal(t, 2, attempts)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		deadlock := &pgconn.PgError{Code: "40P01"}
+		for range 2 {
+			mock.ExpectBegin()
+			mock.ExpectRollback()
+		}
+
+		err = dbutils.Transaction(context.Background(), mock, func(_ pgx.Tx) error {
+			return deadlock
+		}, dbutils.WithRetry(2, dbutils.WithBackoff(time.Millisecond, time.Millisecond)))
+		var retryErr *dbutils.RetryError
+		require.ErrorAs(t, err, &retryErr)
+		assert.Equal(t, 2, retryErr.Attempts)
+		assert.ErrorIs(t, err, deadlock)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("do not retry other errors", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		expErr := errors.New("test")
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		err = dbutils.Transaction(context.Background(), mock, func(_ pgx.Tx) error {
+			return expErr
+		}, dbutils.WithRetry(3))
+		assert.Equal(t, "transaction rollback: test", err.Error())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("retry classified errors", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		expErr := errors.New("test")
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		attempts := 0
+		require.NoError(t, dbutils.Transaction(context.Background(), mock, func(_ pgx.Tx) error {
+			attempts++
+			if attempts == 1 {
+				return expErr
+			}
+			return nil
+		}, dbutils.WithRetry(3,
+			dbutils.WithBackoff(time.Millisecond, time.Millisecond),
+			dbutils.WithRetryClassifier(func(err error) bool {
+				return errors.Is(err, expErr)
+			}),
+		)))
+		assert.Equal(t, 2, attempts)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("context cancelled between attempts", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		err = dbutils.Transaction(ctx, mock, func(_ pgx.Tx) error {
+			cancel()
+			return serializationFailure
+		}, dbutils.WithRetry(3, dbutils.WithBackoff(time.Minute, time.Minute)))
+		var retryErr *dbutils.RetryError
+		require.ErrorAs(t, err, &retryErr)
+		assert.Equal(t, 1, retryErr.Attempts)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.ErrorIs(t, err, serializationFailure)
+		// The rollback must not be cancelled together with ctx, otherwise its error hides the retryable one.
+		assert.NotContains(t, err.Error(), "failed to roll back")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,284 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrNotFound = errors.New("no rows found")
+)
+
+// ScanMode configures how QueryAll, QueryOne and QueryIter map columns to struct fields. It is passed among the query
+// arguments, like the query options of pgx.
+type ScanMode int
+
+const (
+	// ScanLax ignores columns without a field and leaves fields without a column at their zero value. It is the
+	// default.
+	ScanLax ScanMode = iota
+	// ScanStrict returns a MappingError if a column has no field or a field has no column.
+	ScanStrict
+)
+
+// MappingError is returned in ScanStrict mode if the columns of the result do not match the fields of the struct.
+type MappingError struct {
+	Type            string
+	UnmappedColumns []string
+	MissingColumns  []string
+}
+
+func (e *MappingError) Error() string {
+	var problems []string
+	if len(e.UnmappedColumns) > 0 {
+		problems = append(problems, "columns without field: "+strings.Join(e.UnmappedColumns, ", "))
+	}
+	if len(e.MissingColumns) > 0 {
+		problems = append(problems, "fields without column: "+strings.Join(e.MissingColumns, ", "))
+	}
+	return fmt.Sprintf("could not map result to %s: %s", e.Type, strings.Join(problems, "; "))
+}
+
+// PGXQueryInterface is implemented by *pgx.Conn, *pgxpool.Pool and pgx.Tx.
+type PGXQueryInterface interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// QueryAll runs the query and scans all rows into structs of type T. Columns are mapped to the fields by their db tag
+// or, without tag, by the field name, case-insensitively. Fields tagged with db:"-" are skipped, the fields of
+// embedded structs are mapped like fields of T. Pointer fields are set to nil for NULL.
+func QueryAll[T any](ctx context.Context, db PGXQueryInterface, sql string, args ...any) ([]T, error) {
+	args, mode := scanMode(args)
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, rowToStruct[T](mode))
+}
+
+// QueryOne behaves like QueryAll, but expects exactly one row. If there is none, an error matching ErrNotFound and
+// pgx.ErrNoRows is returned, if there are more, pgx.ErrTooManyRows.
+func QueryOne[T any](ctx context.Context, db PGXQueryInterface, sql string, args ...any) (T, error) {
+	args, mode := scanMode(args)
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	result, err := pgx.CollectExactlyOneRow(rows, rowToStruct[T](mode))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return result, fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return result, err
+}
+
+// RowIter iterates over the rows of QueryIter. It has to be closed, unless Next returned false.
+type RowIter[T any] struct {
+	rows  pgx.Rows
+	scan  pgx.RowToFunc[T]
+	value T
+	err   error
+}
+
+// QueryIter behaves like QueryAll, but scans the rows one by one, so large results do not have to be kept in memory.
+func QueryIter[T any](ctx context.Context, db PGXQueryInterface, sql string, args ...any) (*RowIter[T], error) {
+	args, mode := scanMode(args)
+	rows, err := db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &RowIter[T]{rows: rows, scan: rowToStruct[T](mode)}, nil
+}
+
+// Next scans the next row. It returns false after the last row or on errors, which are reported by Err.
+func (it *RowIter[T]) Next() bool {
+	if it.err != nil || !it.rows.Next() {
+		it.rows.Close()
+		return false
+	}
+	it.value, it.err = it.scan(it.rows)
+	if it.err != nil {
+		it.rows.Close()
+		return false
+	}
+	return true
+}
+
+// Value returns the row scanned by Next.
+func (it *RowIter[T]) Value() T {
+	return it.value
+}
+
+// Err returns the error that stopped the iteration.
+func (it *RowIter[T]) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.rows.Err()
+}
+
+// Close closes the rows.
+func (it *RowIter[T]) Close() {
+	it.rows.Close()
+}
+
+// scanMode removes the ScanMode from args.
+func scanMode(args []any) ([]any, ScanMode) {
+	mode := ScanLax
+	return slices.DeleteFunc(slices.Clone(args), func(arg any) bool {
+		m, ok := arg.(ScanMode)
+		if ok {
+			mode = m
+		}
+		return ok
+	}), mode
+}
+
+// structField is a field of a struct, including the fields of embedded structs.
+type structField struct {
+	name  string
+	index []int
+}
+
+// structFields maps the lower case column names to the fields of a struct type.
+type structFields struct {
+	byColumn map[string]structField
+	columns  []string
+}
+
+var structFieldsCache sync.Map
+
+func fieldsOf(t reflect.Type) *structFields {
+	if fields, ok := structFieldsCache.Load(t); ok {
+		return fields.(*structFields)
+	}
+	fields := &structFields{byColumn: make(map[string]structField)}
+	depths := make(map[string]int)
+	collectFields(t, nil, fields, depths)
+	structFieldsCache.Store(t, fields)
+	return fields
+}
+
+// collectFields adds the fields of t to fields. Like in Go, fields of outer structs hide the ones of embedded structs.
+func collectFields(t reflect.Type, index []int, fields *structFields, depths map[string]int) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag, hasTag := f.Tag.Lookup("db")
+		tag, _, _ = strings.Cut(tag, ",")
+		if tag == "-" {
+			continue
+		}
+		fieldIndex := append(slices.Clone(index), i)
+		if f.Anonymous && !hasTag {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			// Embedded pointers can only be allocated if they are exported.
+			if embedded.Kind() == reflect.Struct && (f.Type.Kind() != reflect.Pointer || f.IsExported()) {
+				collectFields(embedded, fieldIndex, fields, depths)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag != "" {
+			name = tag
+		}
+		column := strings.ToLower(name)
+		if depth, ok := depths[column]; ok && depth <= len(index) {
+			continue
+		}
+		if _, ok := depths[column]; !ok {
+			fields.columns = append(fields.columns, column)
+		}
+		depths[column] = len(index)
+		fields.byColumn[column] = structField{name: name, index: fieldIndex}
+	}
+}
+
+// rowToStruct returns a pgx.RowToFunc that scans rows into structs of type T. The columns are mapped on the first row.
+func rowToStruct[T any](mode ScanMode) pgx.RowToFunc[T] {
+	var (
+		mapping []structField
+		mapErr  error
+	)
+	return func(row pgx.CollectableRow) (T, error) {
+		var value T
+		v := reflect.ValueOf(&value).Elem()
+		if v.Kind() != reflect.Struct {
+			return value, fmt.Errorf("could not map result to %s: not a struct", v.Type())
+		}
+		if mapping == nil && mapErr == nil {
+			mapping, mapErr = mapColumns(v.Type(), row.FieldDescriptions(), mode)
+		}
+		if mapErr != nil {
+			return value, mapErr
+		}
+		targets := make([]any, len(mapping))
+		for i, field := range mapping {
+			if field.index != nil {
+				targets[i] = fieldByIndex(v, field.index).Addr().Interface()
+			}
+		}
+		if err := row.Scan(targets...); err != nil {
+			return value, err
+		}
+		return value, nil
+	}
+}
+
+// mapColumns returns the field of each column. Columns without field get an empty structField and are skipped.
+func mapColumns(t reflect.Type, columns []pgconn.FieldDescription, mode ScanMode) ([]structField, error) {
+	fields := fieldsOf(t)
+	mapping := make([]structField, len(columns))
+	mapped := make(map[string]bool)
+	var unmapped []string
+	for i, column := range columns {
+		name := strings.ToLower(column.Name)
+		field, ok := fields.byColumn[name]
+		if !ok {
+			unmapped = append(unmapped, column.Name)
+			continue
+		}
+		mapping[i] = field
+		mapped[name] = true
+	}
+	if mode != ScanStrict {
+		return mapping, nil
+	}
+	var missing []string
+	for _, column := range fields.columns {
+		if !mapped[column] {
+			missing = append(missing, fields.byColumn[column].name)
+		}
+	}
+	if len(unmapped) > 0 || len(missing) > 0 {
+		return nil, &MappingError{Type: t.String(), UnmappedColumns: unmapped, MissingColumns: missing}
+	}
+	return mapping, nil
+}
+
+// fieldByIndex behaves like reflect.Value.FieldByIndex, but allocates nil embedded pointers.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
@@ -0,0 +1,167 @@
+package dbutils_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type audit struct {
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type user struct {
+	audit
+	ID       int     `db:"id"`
+	Name     string  `db:"name"`
+	Email    *string `db:"email"`
+	Password string  `db:"-"`
+}
+
+func TestQueryAll(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	email := "a@example.com"
+
+	t.Run("map columns", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectQuery("SELECT id, name, email, created_at, last_login FROM users").
+			WithArgs(true).
+			WillReturnRows(mock.
+				NewRows([]string{"id", "name", "email", "created_at", "last_login"}).
+				AddRow(1, "a", &email, createdAt, createdAt).
+				AddRow(2, "b", (*string)(nil), createdAt, createdAt),
+			)
+
+		users, err := dbutils.QueryAll[user](
+			context.Background(),
+			mock,
+			"SELECT id, name, email, created_at, last_login FROM users WHERE active = $1",
+			true,
+		)
+		require.NoError(t, err)
+		assert.Equal(t, []user{
+			{audit: audit{CreatedAt: createdAt}, ID: 1, Name: "a", Email: &email},
+			{audit: audit{CreatedAt: createdAt}, ID: 2, Name: "b"},
+		}, users)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectQuery("SELECT id, name, last_login FROM users").
+			WithArgs(true).
+			WillReturnRows(mock.NewRows([]string{"id", "name", "last_login"}).AddRow(1, "a", createdAt))
+
+		_, err = dbutils.QueryAll[user](
+			context.Background(),
+			mock,
+			"SELECT id, name, last_login FROM users WHERE active = $1",
+			true,
+			dbutils.ScanStrict,
+		)
+		var mappingErr *dbutils.MappingError
+		require.ErrorAs(t, err, &mappingErr)
+		assert.Equal(t, []string{"last_login"}, mappingErr.UnmappedColumns)
+		assert.Equal(t, []string{"created_at", "email"}, mappingErr.MissingColumns)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestQueryOne(t *testing.T) {
+	t.Run("not found", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectQuery("SELECT id, name FROM users").
+			WithArgs(1).
+			WillReturnRows(mock.NewRows([]string{"id", "name"}))
+
+		_, err = dbutils.QueryOne[user](context.Background(), mock, "SELECT id, name FROM users WHERE id = $1", 1)
+		assert.ErrorIs(t, err, dbutils.ErrNotFound)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("too many rows", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectQuery("SELECT id, name FROM users").
+			WillReturnRows(mock.NewRows([]string{"id", "name"}).AddRow(1, "a").AddRow(2, "b"))
+
+		_, err = dbutils.QueryOne[user](context.Background(), mock, "SELECT id, name FROM users")
+		assert.ErrorIs(t, err, pgx.ErrTooManyRows)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestQueryIter(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close(context.Background())
+	mock.
+		ExpectQuery("SELECT id, name FROM users").
+		WillReturnRows(mock.NewRows([]string{"id", "name"}).AddRow(1, "a").AddRow(2, "b"))
+
+	it, err := dbutils.QueryIter[user](context.Background(), mock, "SELECT id, name FROM users")
+	require.NoError(t, err)
+	var names []string
+	for it.Next() {
+		names = append(names, it.Value().Name)
+	}
+	require.NoError(t, it.Err())
+	assert.Equal(t, []string{"a", "b"}, names)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPGXQueryAll(t *testing.T) {
+	ctx := context.Background()
+	type row struct {
+		A *string `db:"a"`
+		B int     `db:"b"`
+	}
+	err := dbutils.Transaction(ctx, pgxPool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "INSERT INTO test (A, B) VALUES (NULL, 1001), ('scan', 1002)"); err != nil {
+			return err
+		}
+		rows, err := dbutils.QueryAll[row](
+			ctx, tx, "SELECT a, b FROM test WHERE b > 1000 ORDER BY b", dbutils.ScanStrict,
+		)
+		if err != nil {
+			return err
+		}
+		require.Len(t, rows, 2)
+		assert.Nil(t, rows[0].A)
+		assert.Equal(t, "scan", *rows[1].A)
+
+		_, err = dbutils.QueryOne[row](ctx, tx, "SELECT a, b FROM test WHERE b = $1", 0)
+		assert.ErrorIs(t, err, dbutils.ErrNotFound)
+		return errors.New("roll back")
+	})
+	assert.EqualError(t, err, "transaction rollback: roll back")
+}
@@ -0,0 +1,148 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	defaultSemaphoreBaseDelay = 50 * time.Millisecond
+	defaultSemaphoreMaxDelay  = 2 * time.Second
+)
+
+var (
+	ErrInvalidCapacity = errors.New("semaphore capacity must be positive")
+)
+
+// Semaphore limits the concurrent executions of something across all database clients to capacity, e.g. 3 exports
+// per tenant. Each of the capacity slots is an advisory lock, holding one of them permits the execution. Advisory locks
+// are reentrant, so acquiring twice on the same connection may return the same slot.
+type Semaphore struct {
+	name     string
+	capacity int
+	locker   *Locker
+	backoff  RetryOptions
+}
+
+// SemaphorePermit is a handle to an acquired slot of a Semaphore.
+type SemaphorePermit struct {
+	Slot int
+
+	locks *AcquiredLocks
+}
+
+// NewSemaphore creates a Semaphore with capacity slots. All Semaphores with the same name share the slots, so they
+// have to be created with the same capacity. If capacity is not positive, acquiring returns ErrInvalidCapacity.
+func NewSemaphore(name string, capacity int, options ...func(*Semaphore)) *Semaphore {
+	s := &Semaphore{
+		name:     name,
+		capacity: capacity,
+		locker:   defaultLocker,
+		backoff:  RetryOptions{baseDelay: defaultSemaphoreBaseDelay, maxDelay: defaultSemaphoreMaxDelay},
+	}
+	for _, o := range options {
+		o(s)
+	}
+	return s
+}
+
+// WithSemaphoreLocker this option computes the keys of the slots with the given Locker.
+func WithSemaphoreLocker(locker *Locker) func(*Semaphore) {
+	return func(s *Semaphore) {
+		s.locker = locker
+	}
+}
+
+// WithSemaphoreBackoff this option configures the exponential backoff of Acquire while all slots are taken. It behaves
+// like WithBackoff.
+func WithSemaphoreBackoff(baseDelay, maxDelay time.Duration) func(*Semaphore) {
+	return func(s *Semaphore) {
+		s.backoff.baseDelay = baseDelay
+		s.backoff.maxDelay = maxDelay
+	}
+}
+
+// Acquire acquires a slot with a transaction level lock. It waits until a slot is free or ctx is done. The slot is
+// held until the transaction ends, releasing the returned SemaphorePermit has no effect.
+func (s *Semaphore) Acquire(ctx context.Context, tx PGXRowInterface) (*SemaphorePermit, error) {
+	return s.acquire(ctx, func() (*SemaphorePermit, error) {
+		return s.TryAcquire(ctx, tx)
+	})
+}
+
+// TryAcquire behaves like Acquire, but returns ErrCouldNotAcquireLock immediately if all slots are taken.
+func (s *Semaphore) TryAcquire(ctx context.Context, tx PGXRowInterface) (*SemaphorePermit, error) {
+	return s.tryAcquire(ctx, tx, "pg_try_advisory_xact_lock")
+}
+
+// AcquireSession acquires a slot with a session level lock. It waits until a slot is free or ctx is done. The slot is
+// held by the connection until the returned SemaphorePermit is released.
+func (s *Semaphore) AcquireSession(ctx context.Context, conn PGXConnInterface) (*SemaphorePermit, error) {
+	return s.acquire(ctx, func() (*SemaphorePermit, error) {
+		return s.TryAcquireSession(ctx, conn)
+	})
+}
+
+// TryAcquireSession behaves like AcquireSession, but returns ErrCouldNotAcquireLock immediately if all slots are
+// taken.
+func (s *Semaphore) TryAcquireSession(ctx context.Context, conn PGXConnInterface) (*SemaphorePermit, error) {
+	permit, err := s.tryAcquire(ctx, conn, "pg_try_advisory_lock")
+	if err != nil {
+		return nil, err
+	}
+	permit.locks = &AcquiredLocks{IDs: []string{s.slotID(permit.Slot)}, conn: conn, locker: s.locker}
+	return permit, nil
+}
+
+// Release releases the slot of a session level permit. Releasing a permit twice is a no-op.
+func (p *SemaphorePermit) Release(ctx context.Context) error {
+	if p.locks == nil {
+		return nil
+	}
+	return p.locks.ReleaseAll(ctx)
+}
+
+func (s *Semaphore) acquire(ctx context.Context, try func() (*SemaphorePermit, error)) (*SemaphorePermit, error) {
+	for attempt := 1; ; attempt++ {
+		permit, err := try()
+		if !errors.Is(err, ErrCouldNotAcquireLock) {
+			return permit, err
+		}
+		timer := time.NewTimer(s.backoff.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// tryAcquire tries all slots once. It starts at a random slot, so concurrent callers do not all compete for the first
+// one.
+func (s *Semaphore) tryAcquire(ctx context.Context, db PGXRowInterface, lockFunc string) (*SemaphorePermit, error) {
+	if s.capacity <= 0 {
+		// Not ErrCouldNotAcquireLock, waiting would never succeed.
+		return nil, ErrInvalidCapacity
+	}
+	offset := rand.N(s.capacity)
+	for i := range s.capacity {
+		slot := (offset + i) % s.capacity
+		var acquired bool
+		call, args := s.locker.Key(s.slotID(slot)).call(lockFunc)
+		if err := db.QueryRow(ctx, "SELECT "+call, args...).Scan(&acquired); err != nil {
+			return nil, fmt.Errorf("could not acquire database advisory lock: %w", err)
+		}
+		if acquired {
+			return &SemaphorePermit{Slot: slot}, nil
+		}
+	}
+	return nil, ErrCouldNotAcquireLock
+}
+
+func (s *Semaphore) slotID(slot int) string {
+	return fmt.Sprintf("%s/%d", s.name, slot)
+}
@@ -0,0 +1,165 @@
+package dbutils_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSemaphore(t *testing.T) {
+	lockRows := func(mock pgxmock.PgxConnIface, acquired bool) *pgxmock.Rows {
+		return mock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(acquired)
+	}
+	slotKey := dbutils.NewLocker().Key("exports/0").Key
+
+	t.Run("acquire waits for a free slot", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		for _, acquired := range []bool{false, false, true} {
+			mock.
+				ExpectQuery("SELECT pg_try_advisory_xact_lock(?)").
+				WithArgs(slotKey).
+				WillReturnRows(lockRows(mock, acquired))
+		}
+
+		semaphore := dbutils.NewSemaphore("exports", 1, dbutils.WithSemaphoreBackoff(time.Millisecond, time.Millisecond))
+		permit, err := semaphore.Acquire(context.Background(), mock)
+		require.NoError(t, err)
+		assert.Equal(t, 0, permit.Slot)
+		assert.NoError(t, permit.Release(context.Background()))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("acquire stops with ctx", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectQuery("SELECT pg_try_advisory_xact_lock(?)").
+			WithArgs(slotKey).
+			WillReturnRows(lockRows(mock, false))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		semaphore := dbutils.NewSemaphore("exports", 1, dbutils.WithSemaphoreBackoff(time.Hour, time.Hour))
+		_, err = semaphore.Acquire(ctx, mock)
+		assert.ErrorIs(t, err, dbutils.ErrCouldNotAcquireLock)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("try acquire with all slots taken", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		for range 3 {
+			mock.
+				ExpectQuery("SELECT pg_try_advisory_xact_lock(?)").
+				WithArgs(pgxmock.AnyArg()).
+				WillReturnRows(lockRows(mock, false))
+		}
+
+		_, err = dbutils.NewSemaphore("exports", 3).TryAcquire(context.Background(), mock)
+		assert.Equal(t, dbutils.ErrCouldNotAcquireLock, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid capacity", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+
+		semaphore := dbutils.NewSemaphore("exports", 0)
+		_, err = semaphore.Acquire(context.Background(), mock)
+		assert.Equal(t, dbutils.ErrInvalidCapacity, err)
+		_, err = semaphore.AcquireSession(context.Background(), mock)
+		assert.Equal(t, dbutils.ErrInvalidCapacity, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("session permit", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectQuery("SELECT pg_try_advisory_lock(?)").
+			WithArgs(slotKey).
+			WillReturnRows(lockRows(mock, true))
+		mock.
+			ExpectQuery("SELECT pg_advisory_unlock(?)").
+			WithArgs(slotKey).
+			WillReturnRows(mock.NewRows([]string{"pg_advisory_unlock"}).AddRow(true))
+
+		permit, err := dbutils.NewSemaphore("exports", 1).TryAcquireSession(context.Background(), mock)
+		require.NoError(t, err)
+		require.NoError(t, permit.Release(context.Background()))
+		assert.NoError(t, permit.Release(context.Background()))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPGXSemaphore(t *testing.T) {
+	ctx := context.Background()
+	semaphore := dbutils.NewSemaphore("semaphore", 2)
+
+	t.Run("session", func(t *testing.T) {
+		var permits []*dbutils.SemaphorePermit
+		for range 2 {
+			conn, err := pgxPool.Acquire(ctx)
+			require.NoError(t, err)
+			defer conn.Release()
+			permit, err := semaphore.TryAcquireSession(ctx, conn.Conn())
+			require.NoError(t, err)
+			permits = append(permits, permit)
+		}
+		assert.NotEqual(t, permits[0].Slot, permits[1].Slot)
+
+		conn, err := pgxPool.Acquire(ctx)
+		require.NoError(t, err)
+		defer conn.Release()
+		_, err = semaphore.TryAcquireSession(ctx, conn.Conn())
+		assert.Equal(t, dbutils.ErrCouldNotAcquireLock, err)
+
+		require.NoError(t, permits[0].Release(ctx))
+		permit, err := semaphore.AcquireSession(ctx, conn.Conn())
+		require.NoError(t, err)
+		assert.Equal(t, permits[0].Slot, permit.Slot)
+		require.NoError(t, permit.Release(ctx))
+		require.NoError(t, permits[1].Release(ctx))
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		err := dbutils.Transaction(ctx, pgxPool, func(tx pgx.Tx) error {
+			if _, err := semaphore.TryAcquire(ctx, tx); err != nil {
+				return err
+			}
+			return dbutils.Transaction(ctx, pgxPool, func(tx2 pgx.Tx) error {
+				if _, err := semaphore.TryAcquire(ctx, tx2); err != nil {
+					return err
+				}
+				return dbutils.Transaction(ctx, pgxPool, func(tx3 pgx.Tx) error {
+					_, err := semaphore.TryAcquire(ctx, tx3)
+					return err
+				})
+			})
+		})
+		assert.ErrorIs(t, err, dbutils.ErrCouldNotAcquireLock)
+	})
+}
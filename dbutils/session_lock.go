@@ -0,0 +1,116 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/4ND3R50N/go-tools/filter"
+)
+
+// UnheldLocksError is returned when releasing session level locks that were not held by the connection anymore, e.g.
+// because they were released manually.
+type UnheldLocksError struct {
+	IDs []string
+}
+
+func (e *UnheldLocksError) Error() string {
+	return fmt.Sprintf("advisory locks were not held: %s", strings.Join(e.IDs, ", "))
+}
+
+// PGXConnInterface is implemented by single connections like *pgx.Conn. Pools do not implement it on purpose, because
+// session level locks have to be released on the same connection they were acquired on.
+type PGXConnInterface interface {
+	PGXInterface
+	PGXRowInterface
+	PgConn() *pgconn.PgConn
+}
+
+// NewPGXSessionLocks acquire pg_advisory_lock locks for each lockID given. Other than NewPGXLocks, the locks are not
+// bound to a transaction but held by the connection until they are released with the returned AcquiredLocks.
+// Duplicates in lockIDs getting filtered out, the others are acquired in LockOrder.
+func NewPGXSessionLocks(ctx context.Context, conn PGXConnInterface, lockIDs ...string) (*AcquiredLocks, error) {
+	return defaultLocker.SessionLock(ctx, conn, lockIDs...)
+}
+
+// NewPGXSharedSessionLocks behaves like NewPGXSessionLocks, but acquires shared pg_advisory_lock_shared locks.
+func NewPGXSharedSessionLocks(ctx context.Context, conn PGXConnInterface, lockIDs ...string) (*AcquiredLocks, error) {
+	return defaultLocker.SharedSessionLock(ctx, conn, lockIDs...)
+}
+
+// SessionLock behaves like NewPGXSessionLocks with the keys of the Locker.
+func (l *Locker) SessionLock(ctx context.Context, conn PGXConnInterface, lockIDs ...string) (*AcquiredLocks, error) {
+	return l.sessionLocks(ctx, conn, false, lockIDs)
+}
+
+// SharedSessionLock behaves like NewPGXSharedSessionLocks with the keys of the Locker.
+func (l *Locker) SharedSessionLock(
+	ctx context.Context,
+	conn PGXConnInterface,
+	lockIDs ...string,
+) (*AcquiredLocks, error) {
+	return l.sessionLocks(ctx, conn, true, lockIDs)
+}
+
+func (l *Locker) sessionLocks(
+	ctx context.Context,
+	conn PGXConnInterface,
+	shared bool,
+	lockIDs []string,
+) (*AcquiredLocks, error) {
+	locks := &AcquiredLocks{conn: conn, locker: l, shared: shared}
+	lockFunc := "pg_advisory_lock"
+	if shared {
+		lockFunc = "pg_advisory_lock_shared"
+	}
+	for _, id := range l.Order(lockIDs...) {
+		call, args := l.Key(id).call(lockFunc)
+		if _, err := conn.Exec(ctx, "SELECT "+call, args...); err != nil {
+			err = fmt.Errorf("could not acquire database advisory lock: %w", err)
+			// Do not keep the locks that were already acquired, nobody could release them.
+			return nil, errors.Join(err, locks.ReleaseAll(context.WithoutCancel(ctx)))
+		}
+		locks.IDs = append(locks.IDs, id)
+	}
+	return locks, nil
+}
+
+// Release releases the given session level locks. Locks that were not held by the connection anymore are reported
+// with an UnheldLocksError.
+func (l *AcquiredLocks) Release(ctx context.Context, lockIDs ...string) error {
+	unlockFunc := "pg_advisory_unlock"
+	if l.shared {
+		unlockFunc = "pg_advisory_unlock_shared"
+	}
+	var unheld []string
+	for _, id := range filter.Distinct(lockIDs) {
+		if !slices.Contains(l.IDs, id) {
+			unheld = append(unheld, id)
+			continue
+		}
+		var released bool
+		call, args := l.locker.Key(id).call(unlockFunc)
+		if err := l.conn.QueryRow(ctx, "SELECT "+call, args...).Scan(&released); err != nil {
+			return fmt.Errorf("could not release database advisory lock: %w", err)
+		}
+		l.IDs = slices.DeleteFunc(l.IDs, func(heldID string) bool {
+			return heldID == id
+		})
+		if !released {
+			unheld = append(unheld, id)
+		}
+	}
+	if len(unheld) > 0 {
+		return &UnheldLocksError{IDs: unheld}
+	}
+	return nil
+}
+
+// ReleaseAll releases all session level locks that are still held.
+func (l *AcquiredLocks) ReleaseAll(ctx context.Context) error {
+	return l.Release(ctx, slices.Clone(l.IDs)...)
+}
@@ -0,0 +1,114 @@
+package dbutils_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPGXSessionLocks(t *testing.T) {
+	unlockRows := func(mock pgxmock.PgxConnIface, released bool) *pgxmock.Rows {
+		return mock.NewRows([]string{"pg_advisory_unlock"}).AddRow(released)
+	}
+
+	t.Run("acquire and release", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectExec("SELECT pg_advisory_lock(?)").
+			WithArgs(int64(-4578387130389545127)).
+			WillReturnResult(pgxmock.NewResult("test", 1))
+		mock.
+			ExpectExec("SELECT pg_advisory_lock(?)").
+			WithArgs(int64(-4578387130389545126)).
+			WillReturnResult(pgxmock.NewResult("test", 1))
+		mock.
+			ExpectQuery("SELECT pg_advisory_unlock(?)").
+			WithArgs(int64(-4578387130389545126)).
+			WillReturnRows(unlockRows(mock, true))
+		mock.
+			ExpectQuery("SELECT pg_advisory_unlock(?)").
+			WithArgs(int64(-4578387130389545127)).
+			WillReturnRows(unlockRows(mock, false))
+
+		locks, err := dbutils.NewPGXSessionLocks(context.Background(), mock, "test1", "test2")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"test2", "test1"}, locks.IDs)
+
+		require.NoError(t, locks.Release(context.Background(), "test1"))
+		assert.Equal(t, []string{"test2"}, locks.IDs)
+
+		err = locks.ReleaseAll(context.Background())
+		var unheldErr *dbutils.UnheldLocksError
+		require.ErrorAs(t, err, &unheldErr)
+		assert.Equal(t, []string{"test2"}, unheldErr.IDs)
+		assert.Empty(t, locks.IDs)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("release already acquired locks on error", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close(context.Background())
+		mock.
+			ExpectExec("SELECT pg_advisory_lock_shared(?)").
+			WithArgs(int64(-4578387130389545127)).
+			WillReturnResult(pgxmock.NewResult("test", 1))
+		mock.
+			ExpectExec("SELECT pg_advisory_lock_shared(?)").
+			WithArgs(int64(-4578387130389545126)).
+			WillReturnError(assert.AnError)
+		mock.
+			ExpectQuery("SELECT pg_advisory_unlock_shared(?)").
+			WithArgs(int64(-4578387130389545127)).
+			WillReturnRows(unlockRows(mock, true))
+
+		locks, err := dbutils.NewPGXSharedSessionLocks(context.Background(), mock, "test1", "test2")
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.Nil(t, locks)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPGXSessionLocks(t *testing.T) {
+	ctx := context.Background()
+	conn, err := pgxPool.Acquire(ctx)
+	require.NoError(t, err)
+	defer conn.Release()
+
+	locks, err := dbutils.NewPGXSessionLocks(ctx, conn.Conn(), "session1")
+	require.NoError(t, err)
+
+	// The lock is held across transactions of the same connection, but not by other connections.
+	require.NoError(t, dbutils.Transaction(ctx, conn.Conn(), func(_ pgx.Tx) error {
+		return nil
+	}))
+	err = dbutils.Transaction(ctx, pgxPool, func(_ pgx.Tx) error {
+		return nil
+	}, dbutils.WithTryAdvisoryLock("session1"))
+	assert.Equal(t, dbutils.ErrCouldNotAcquireLock, err)
+
+	require.NoError(t, locks.ReleaseAll(ctx))
+	require.NoError(t, dbutils.Transaction(ctx, pgxPool, func(_ pgx.Tx) error {
+		return nil
+	}, dbutils.WithTryAdvisoryLock("session1")))
+
+	// Releasing a lock that was released behind the handle's back is reported.
+	locks, err = dbutils.NewPGXSessionLocks(ctx, conn.Conn(), "session1")
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_unlock_all()")
+	require.NoError(t, err)
+	var unheldErr *dbutils.UnheldLocksError
+	require.ErrorAs(t, locks.ReleaseAll(ctx), &unheldErr)
+	assert.Equal(t, []string{"session1"}, unheldErr.IDs)
+}
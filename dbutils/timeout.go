@@ -0,0 +1,101 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type timeouts struct {
+	lock              time.Duration
+	statement         time.Duration
+	idleInTransaction time.Duration
+	fromDeadline      bool
+}
+
+// WithLockTimeout this option configures the local lock timeout. If a lock, e.g. an advisory lock, can not be
+// acquired in time, Transaction returns ErrCouldNotAcquireLock.
+func WithLockTimeout(timeout time.Duration) func(*Options) {
+	return func(t *Options) {
+		t.timeouts.lock = timeout
+	}
+}
+
+// WithStatementTimeout this option configures the local statement timeout. Statements that run longer fail with an
+// error that matches ErrStatementTimeout.
+func WithStatementTimeout(timeout time.Duration) func(*Options) {
+	return func(t *Options) {
+		t.timeouts.statement = timeout
+	}
+}
+
+// WithIdleInTransactionTimeout this option configures the local idle_in_transaction_session_timeout. Postgres
+// terminates the session if the transaction is idle for longer.
+func WithIdleInTransactionTimeout(timeout time.Duration) func(*Options) {
+	return func(t *Options) {
+		t.timeouts.idleInTransaction = timeout
+	}
+}
+
+// WithDeadlineTimeouts this option limits the lock and statement timeouts to the time left until the deadline of the
+// context, so Postgres gives up on its own instead of being cancelled.
+func WithDeadlineTimeouts() func(*Options) {
+	return func(t *Options) {
+		t.timeouts.fromDeadline = true
+	}
+}
+
+// statements returns the SET LOCAL statements for the configured timeouts, or an empty string if there are none.
+func (t timeouts) statements(ctx context.Context) string {
+	lock, statement := t.lock, t.statement
+	if deadline, ok := ctx.Deadline(); ok && t.fromDeadline {
+		remaining := max(time.Until(deadline), time.Millisecond)
+		lock = minTimeout(lock, remaining)
+		statement = minTimeout(statement, remaining)
+	}
+	var statements []string
+	for _, setting := range []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{name: "lock_timeout", timeout: lock},
+		{name: "statement_timeout", timeout: statement},
+		{name: "idle_in_transaction_session_timeout", timeout: t.idleInTransaction},
+	} {
+		if setting.timeout > 0 {
+			statements = append(statements, fmt.Sprintf("SET LOCAL %s = '%dms';", setting.name, milliseconds(setting.timeout)))
+		}
+	}
+	return strings.Join(statements, " ")
+}
+
+// classify classifies err like ClassifyError. A cancelled query is classified as ErrStatementTimeout if the
+// transaction set a statement timeout and ctx was not cancelled, because the client cancels queries on cancellation of
+// ctx.
+func (o *Options) classify(ctx context.Context, err error) error {
+	err = ClassifyError(err)
+	statementTimeout := o.timeouts.statement > 0
+	if _, ok := ctx.Deadline(); ok && o.timeouts.fromDeadline {
+		statementTimeout = true
+	}
+	var dbErr *DBError
+	if statementTimeout && ctx.Err() == nil && errors.As(err, &dbErr) && dbErr.Kind == ErrQueryCanceled {
+		dbErr.Kind = ErrStatementTimeout
+	}
+	return err
+}
+
+// minTimeout returns the smaller timeout, where zero means that there is no timeout.
+func minTimeout(timeout, remaining time.Duration) time.Duration {
+	if timeout <= 0 {
+		return remaining
+	}
+	return min(timeout, remaining)
+}
+
+// milliseconds rounds the timeout up to whole milliseconds, because zero would disable the timeout.
+func milliseconds(timeout time.Duration) int64 {
+	return int64((timeout + time.Millisecond - 1) / time.Millisecond)
+}
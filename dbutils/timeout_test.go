@@ -0,0 +1,134 @@
+package dbutils_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeouts(t *testing.T) {
+	t.Run("set local timeouts", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.
+			ExpectExec(regexp.QuoteMeta("SET LOCAL lock_timeout = '1500ms'; " +
+				"SET LOCAL statement_timeout = '1ms'; " +
+				"SET LOCAL idle_in_transaction_session_timeout = '60000ms';")).
+			WillReturnResult(pgxmock.NewResult("SET", 0))
+		mock.ExpectCommit()
+
+		require.NoError(t, dbutils.Transaction(context.Background(), mock, func(_ pgx.Tx) error {
+			return nil
+		},
+			dbutils.WithLockTimeout(1500*time.Millisecond),
+			dbutils.WithStatementTimeout(time.Microsecond),
+			dbutils.WithIdleInTransactionTimeout(time.Minute),
+		))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("timeouts from context deadline", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		mock.ExpectBegin()
+		mock.
+			ExpectExec(regexp.QuoteMeta("SET LOCAL lock_timeout = '1000ms'; SET LOCAL statement_timeout = '") +
+				`[56]\d{4}ms';$`).
+			WillReturnResult(pgxmock.NewResult("SET", 0))
+		mock.ExpectCommit()
+
+		require.NoError(t, dbutils.Transaction(ctx, mock, func(_ pgx.Tx) error {
+			return nil
+		}, dbutils.WithLockTimeout(time.Second), dbutils.WithDeadlineTimeouts()))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("statement timeout", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.
+			ExpectExec(regexp.QuoteMeta("SET LOCAL statement_timeout = '100ms';")).
+			WillReturnResult(pgxmock.NewResult("SET", 0))
+		mock.ExpectExec("SELECT pg_sleep").WillReturnError(&pgconn.PgError{Code: "57014"})
+		mock.ExpectRollback()
+
+		err = dbutils.Transaction(context.Background(), mock, func(tx pgx.Tx) error {
+			_, err := tx.Exec(context.Background(), "SELECT pg_sleep(1)")
+			return err
+		}, dbutils.WithStatementTimeout(100*time.Millisecond))
+		assert.ErrorIs(t, err, dbutils.ErrStatementTimeout)
+		assert.ErrorIs(t, err, dbutils.ErrQueryCanceled)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("cancelled query with statement timeout", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		mock.ExpectBegin()
+		mock.
+			ExpectExec(regexp.QuoteMeta("SET LOCAL statement_timeout = '100ms';")).
+			WillReturnResult(pgxmock.NewResult("SET", 0))
+		mock.ExpectExec("SELECT pg_sleep").WillReturnError(&pgconn.PgError{Code: "57014"})
+		mock.ExpectRollback()
+
+		// The client cancelled the query, it did not time out.
+		err = dbutils.Transaction(ctx, mock, func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, "SELECT pg_sleep(1)")
+			cancel()
+			return err
+		}, dbutils.WithStatementTimeout(100*time.Millisecond))
+		assert.ErrorIs(t, err, dbutils.ErrQueryCanceled)
+		assert.NotErrorIs(t, err, dbutils.ErrStatementTimeout)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPGXTimeouts(t *testing.T) {
+	ctx := context.Background()
+	err := dbutils.Transaction(ctx, pgxPool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "SELECT pg_sleep(1)")
+		return err
+	}, dbutils.WithStatementTimeout(100*time.Millisecond))
+	assert.ErrorIs(t, err, dbutils.ErrStatementTimeout)
+
+	// A savepoint must not change the timeouts of the enclosing transaction.
+	err = dbutils.Transaction(ctx, pgxPool, func(tx pgx.Tx) error {
+		err := dbutils.Transaction(ctx, tx, func(_ pgx.Tx) error {
+			return nil
+		}, dbutils.WithStatementTimeout(time.Millisecond))
+		var optionsErr *dbutils.OptionsError
+		assert.ErrorAs(t, err, &optionsErr)
+		var statementTimeout string
+		if err := tx.QueryRow(ctx, "SHOW statement_timeout").Scan(&statementTimeout); err != nil {
+			return err
+		}
+		assert.Equal(t, "5s", statementTimeout)
+		return nil
+	}, dbutils.WithStatementTimeout(5*time.Second))
+	assert.NoError(t, err)
+}
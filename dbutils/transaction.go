@@ -4,7 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
+	"slices"
 
 	"github.com/jackc/pgx/v5"
 )
@@ -13,61 +13,292 @@ var (
 	ErrCouldNotAcquireLock = errors.New("could not acquire database lock")
 )
 
+// OptionsError is returned by Transaction if the given options are not accepted by Postgres. No transaction is opened
+// in that case.
+type OptionsError struct {
+	Option string
+	Reason string
+}
+
+func (e *OptionsError) Error() string {
+	return fmt.Sprintf("invalid transaction option %s: %s", e.Option, e.Reason)
+}
+
+// Beginner is implemented by everything Transaction can open a transaction on, e.g. *pgx.Conn, *pgxpool.Pool and
+// pgx.Tx.
+type Beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// txBeginner is implemented by connections and pools that are able to open top level transactions.
+type txBeginner interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
 type Options struct {
-	locks          []string
-	timeoutSeconds uint8
+	locks        []string
+	sharedLocks  []string
+	tryLocks     []string
+	batchedLocks bool
+	locker       *Locker
+	timeouts     timeouts
+	retry        *RetryOptions
+	txOptions    pgx.TxOptions
+	propagation  Propagation
+	onLocked     func(lockIDs []string)
 }
 
-// WithAdvisoryLock this option configures advisory locks to the given transaction.
+// WithAdvisoryLock this option configures advisory locks to the given transaction. All advisory locks of the
+// transaction are acquired in the Order of its Locker, see LockOrder and WithOnLocked.
 func WithAdvisoryLock(key string) func(*Options) {
 	return func(t *Options) {
 		t.locks = append(t.locks, key)
 	}
 }
 
-// WithLockTimeout this option configures the local lock timeout.
-func WithLockTimeout(timeoutSeconds uint8) func(*Options) {
+// WithSharedAdvisoryLock this option configures shared advisory locks to the given transaction. They only wait for
+// transactions holding an exclusive lock on the same key. If the key is also locked exclusively by WithAdvisoryLock,
+// the exclusive lock is taken only. Exclusive and shared locks are acquired together in LockOrder.
+func WithSharedAdvisoryLock(key string) func(*Options) {
 	return func(t *Options) {
-		t.timeoutSeconds = timeoutSeconds
+		t.sharedLocks = append(t.sharedLocks, key)
+	}
+}
+
+// WithBatchedLocks this option acquires all advisory locks of the transaction in a single round trip.
+func WithBatchedLocks() func(*Options) {
+	return func(t *Options) {
+		t.batchedLocks = true
+	}
+}
+
+// WithOnLocked this option configures a callback that gets the lockIDs of the transaction in the order they were
+// acquired in, e.g. to log them. Try locks are acquired before the others.
+func WithOnLocked(onLocked func(lockIDs []string)) func(*Options) {
+	return func(t *Options) {
+		t.onLocked = onLocked
+	}
+}
+
+// WithLocker this option computes the keys of all advisory locks of the transaction with the given Locker, e.g. to
+// use a namespace.
+func WithLocker(locker *Locker) func(*Options) {
+	return func(t *Options) {
+		t.locker = locker
+	}
+}
+
+// WithTryAdvisoryLock this option configures advisory locks to the given transaction that are not waited for. If the
+// lock is held by someone else, Transaction returns ErrCouldNotAcquireLock immediately.
+func WithTryAdvisoryLock(key string) func(*Options) {
+	return func(t *Options) {
+		t.tryLocks = append(t.tryLocks, key)
+	}
+}
+
+// WithIsolation this option configures the isolation level of the transaction.
+func WithIsolation(isoLevel pgx.TxIsoLevel) func(*Options) {
+	return func(t *Options) {
+		t.txOptions.IsoLevel = isoLevel
+	}
+}
+
+// WithReadOnly this option opens the transaction in read only mode.
+func WithReadOnly() func(*Options) {
+	return func(t *Options) {
+		t.txOptions.AccessMode = pgx.ReadOnly
+	}
+}
+
+// WithDeferrable this option opens the transaction in deferrable mode. Postgres only defers serializable read only
+// transactions, so it has to be combined with WithIsolation(pgx.Serializable) and WithReadOnly.
+func WithDeferrable() func(*Options) {
+	return func(t *Options) {
+		t.txOptions.DeferrableMode = pgx.Deferrable
 	}
 }
 
 // Transaction opens a transaction with the possibility of special options that are bound to it. The code that runs in
 // the do parameter function is fully transactional with all its options.
+// Postgres errors are classified by ClassifyError, so they can be checked with errors.Is, e.g. ErrUniqueViolation.
+// The transaction is rolled back on every error, if do panics (the panic is passed on) and if ctx is cancelled.
+// do can register callbacks with OnCommit and OnRollback that run after the transaction ended.
+// If db is already a transaction (pgx.Tx), do runs inside a savepoint of it instead of a new top level transaction.
+// Timeouts can not be set on savepoints, because they would outlive them, an OptionsError is returned instead.
+// The transaction is not put into ctx, so Querier(ctx, db) does not return it inside do. Use TransactionContext or
+// ContextWithTx for that.
 func Transaction(
 	ctx context.Context,
-	db *pgx.Conn,
+	db Beginner,
 	do func(tx pgx.Tx) error,
 	options ...func(*Options),
 ) error {
-	opts := &Options{}
+	return runTransaction(ctx, db, func(_ context.Context, tx pgx.Tx) error {
+		return do(tx)
+	}, options)
+}
+
+// TransactionResult behaves like Transaction, but returns the result of do. If the transaction is rolled back, the zero
+// value of T is returned. If it was committed, but OnCommit callbacks failed, the result is returned together with
+// the HookError.
+func TransactionResult[T any](
+	ctx context.Context,
+	db Beginner,
+	do func(tx pgx.Tx) (T, error),
+	options ...func(*Options),
+) (T, error) {
+	var result T
+	if err := Transaction(ctx, db, func(tx pgx.Tx) error {
+		var err error
+		result, err = do(tx)
+		return err
+	}, options...); err != nil {
+		// The result is kept if only the hooks failed after the commit, the data is written after all.
+		var hookErr *HookError
+		if errors.As(err, &hookErr) && hookErr.Committed {
+			return result, err
+		}
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// runTransaction implements Transaction and TransactionContext. do gets a context that carries the transaction.
+func runTransaction(
+	ctx context.Context,
+	db Beginner,
+	do func(ctx context.Context, tx pgx.Tx) error,
+	options []func(*Options),
+) error {
+	opts := &Options{locker: defaultLocker}
 	for _, o := range options {
 		o(opts)
 	}
-	tx, err := db.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
+	if active, ok := ctx.Value(txContextKey{}).(*hookTx); ok {
+		if _, ok := db.(txBeginner); ok {
+			if opts.propagation == PropagationJoin {
+				return ClassifyError(join(ctx, active, do, opts))
+			}
+			db = active
+		}
+	}
+	if err := opts.validate(db); err != nil {
 		return err
 	}
-	if opts.timeoutSeconds > 0 {
-		_, err = tx.Exec(ctx, fmt.Sprintf("SET LOCAL lock_timeout = '%ds';", opts.timeoutSeconds))
-		if err != nil {
+	// Only the hooks of the last attempt are run.
+	var hooks *hookTx
+	run := func() error {
+		var err error
+		hooks, err = transaction(ctx, db, do, opts)
+		return opts.classify(ctx, err)
+	}
+	var err error
+	if _, ok := db.(txBeginner); ok && opts.retry != nil {
+		err = opts.retry.run(ctx, run)
+	} else {
+		err = run()
+	}
+	return hooks.run(ctx, err)
+}
+
+// transaction runs a single attempt of Transaction. It returns the hooks registered by do, if the transaction was
+// opened.
+func transaction(
+	ctx context.Context,
+	db Beginner,
+	do func(ctx context.Context, tx pgx.Tx) error,
+	opts *Options,
+) (*hookTx, error) {
+	sqlTx, err := begin(ctx, db, opts.txOptions)
+	if err != nil {
+		return nil, err
+	}
+	parent, _ := db.(*hookTx)
+	_, topLevel := db.(txBeginner)
+	tx := &hookTx{Tx: sqlTx, parent: parent, detached: parent == nil && !topLevel || parent != nil && parent.detached}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback(context.WithoutCancel(ctx))
+			// The errors of the hooks are lost, the panic is passed on.
+			_ = tx.run(context.WithoutCancel(ctx), fmt.Errorf("transaction panicked: %v", p))
+			panic(p)
+		}
+	}()
+	if err := prepare(ctx, tx, opts); err != nil {
+		return tx, rollback(ctx, tx, err)
+	}
+	if err := do(context.WithValue(ctx, txContextKey{}, tx), tx); err != nil {
+		return tx, rollback(ctx, tx, fmt.Errorf("transaction rollback: %w", err))
+	}
+	if err := ctx.Err(); err != nil {
+		return tx, rollback(ctx, tx, fmt.Errorf("transaction rollback: %w", err))
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return tx, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// prepare applies the timeouts and advisory locks of opts to tx.
+func prepare(ctx context.Context, tx pgx.Tx, opts *Options) error {
+	if statements := opts.timeouts.statements(ctx); statements != "" {
+		if _, err := tx.Exec(ctx, statements); err != nil {
 			return err
 		}
 	}
-	if err := NewPGXLocks(ctx, tx, opts.locks...); err != nil {
-		if strings.Contains(err.Error(), "ERROR: canceling statement due to lock timeout (SQLSTATE 55P03)") {
+	if _, err := opts.locker.TryLockAll(ctx, tx, opts.tryLocks...); err != nil {
+		return err
+	}
+	if err := opts.locker.locks(ctx, tx, opts.locks, opts.sharedLocks, opts.batchedLocks); err != nil {
+		if errors.Is(ClassifyError(err), ErrLockTimeout) {
 			return ErrCouldNotAcquireLock
 		}
 		return err
 	}
-	if err := do(tx); err != nil {
-		if err := tx.Rollback(ctx); err != nil {
-			return fmt.Errorf("failed to roll back transaction: %w", err)
-		}
-		return fmt.Errorf("transaction rollback: %w", err)
+	if opts.onLocked != nil {
+		order := opts.locker.Order(opts.tryLocks...)
+		order = append(order, opts.locker.Order(append(slices.Clone(opts.locks), opts.sharedLocks...)...)...)
+		opts.onLocked(order)
 	}
-	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	return nil
+}
+
+// rollback rolls back tx because of err. If the rollback fails as well, both errors are joined. The rollback is not
+// cancelled together with ctx, because the transaction has to be ended either way.
+func rollback(ctx context.Context, tx pgx.Tx, err error) error {
+	if rollbackErr := tx.Rollback(context.WithoutCancel(ctx)); rollbackErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to roll back transaction: %w", rollbackErr))
+	}
+	return err
+}
+
+// begin opens a top level transaction on connections and pools. Transactions only support pgx.Tx.Begin, which creates
+// a savepoint.
+func begin(ctx context.Context, db Beginner, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	if b, ok := db.(txBeginner); ok {
+		return b.BeginTx(ctx, txOptions)
+	}
+	return db.Begin(ctx)
+}
+
+// validate checks the options for combinations that Postgres rejects.
+func (o *Options) validate(db Beginner) error {
+	switch o.txOptions.IsoLevel {
+	case "", pgx.Serializable, pgx.RepeatableRead, pgx.ReadCommitted, pgx.ReadUncommitted:
+	default:
+		return &OptionsError{Option: "isolation", Reason: fmt.Sprintf("unknown isolation level %q", o.txOptions.IsoLevel)}
+	}
+	if o.txOptions.DeferrableMode == pgx.Deferrable &&
+		(o.txOptions.IsoLevel != pgx.Serializable || o.txOptions.AccessMode != pgx.ReadOnly) {
+		return &OptionsError{Option: "deferrable", Reason: "requires a serializable read only transaction"}
+	}
+	if _, ok := db.(txBeginner); !ok && o.txOptions != (pgx.TxOptions{}) {
+		return &OptionsError{Option: "savepoint", Reason: "isolation level, access and deferrable mode are inherited"}
+	}
+	// Releasing a savepoint keeps its SET LOCAL values, they would apply to the rest of the enclosing transaction.
+	if _, ok := db.(txBeginner); !ok && o.timeouts != (timeouts{}) {
+		return &OptionsError{Option: "timeout", Reason: "timeouts would apply to the whole enclosing transaction"}
 	}
 	return nil
 }
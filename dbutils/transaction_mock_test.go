@@ -0,0 +1,267 @@
+package dbutils_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// savepointTx hides BeginTx of the mock, so Transaction treats it like a pgx.Tx.
+type savepointTx struct {
+	pgx.Tx
+}
+
+func TestTransactionOptions(t *testing.T) {
+	t.Run("serializable read only deferrable", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBeginTx(pgx.TxOptions{
+			IsoLevel:       pgx.Serializable,
+			AccessMode:     pgx.ReadOnly,
+			DeferrableMode: pgx.Deferrable,
+		})
+		mock.ExpectCommit()
+
+		require.NoError(t, dbutils.Transaction(
+			context.Background(),
+			mock,
+			func(_ pgx.Tx) error { return nil },
+			dbutils.WithIsolation(pgx.Serializable),
+			dbutils.WithReadOnly(),
+			dbutils.WithDeferrable(),
+		))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid combinations", func(t *testing.T) {
+		type TestCase struct {
+			name    string
+			db      func(mock pgxmock.PgxPoolIface) dbutils.Beginner
+			options []func(*dbutils.Options)
+			option  string
+		}
+		pool := func(mock pgxmock.PgxPoolIface) dbutils.Beginner { return mock }
+		testCases := []TestCase{{
+			name:    "deferrable without serializable",
+			db:      pool,
+			options: []func(*dbutils.Options){dbutils.WithReadOnly(), dbutils.WithDeferrable()},
+			option:  "deferrable",
+		}, {
+			name: "deferrable without read only",
+			db:   pool,
+			options: []func(*dbutils.Options){
+				dbutils.WithIsolation(pgx.Serializable), dbutils.WithDeferrable(),
+			},
+			option: "deferrable",
+		}, {
+			name:    "unknown isolation level",
+			db:      pool,
+			options: []func(*dbutils.Options){dbutils.WithIsolation("chaos")},
+			option:  "isolation",
+		}, {
+			name:    "isolation level of savepoint",
+			db:      func(mock pgxmock.PgxPoolIface) dbutils.Beginner { return savepointTx{mock} },
+			options: []func(*dbutils.Options){dbutils.WithIsolation(pgx.Serializable)},
+			option:  "savepoint",
+		}, {
+			name:    "timeout of savepoint",
+			db:      func(mock pgxmock.PgxPoolIface) dbutils.Beginner { return savepointTx{mock} },
+			options: []func(*dbutils.Options){dbutils.WithStatementTimeout(time.Second)},
+			option:  "timeout",
+		}}
+
+		for _, tt := range testCases {
+			tt := tt
+			t.Run(tt.name, func(t *testing.T) {
+				mock, err := pgxmock.NewPool()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer mock.Close()
+
+				err = dbutils.Transaction(
+					context.Background(),
+					tt.db(mock),
+					func(_ pgx.Tx) error { return nil },
+					tt.options...,
+				)
+				var optionsErr *dbutils.OptionsError
+				require.ErrorAs(t, err, &optionsErr)
+				assert.Equal(t, tt.option, optionsErr.Option)
+				assert.NoError(t, mock.ExpectationsWereMet())
+			})
+		}
+	})
+}
+
+func TestTransactionRollback(t *testing.T) {
+	expErr := errors.New("test")
+
+	t.Run("setting timeouts fails", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectExec("SET LOCAL lock_timeout").WillReturnError(expErr)
+		mock.ExpectRollback()
+
+		err = dbutils.Transaction(context.Background(), mock, func(_ pgx.Tx) error {
+			t.Error("should not be called")
+			return nil
+		}, dbutils.WithLockTimeout(time.Second))
+		assert.ErrorIs(t, err, expErr)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("acquiring locks fails", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.
+			ExpectExec("SELECT pg_advisory_xact_lock").
+			WithArgs(int64(-4578387130389545126)).
+			WillReturnError(expErr)
+		mock.ExpectRollback()
+
+		err = dbutils.Transaction(context.Background(), mock, func(_ pgx.Tx) error {
+			t.Error("should not be called")
+			return nil
+		}, dbutils.WithAdvisoryLock("test1"))
+		assert.ErrorIs(t, err, expErr)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		assert.PanicsWithValue(t, "test", func() {
+			_ = dbutils.Transaction(context.Background(), mock, func(_ pgx.Tx) error {
+				panic("test")
+			})
+		})
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		err = dbutils.Transaction(ctx, mock, func(_ pgx.Tx) error {
+			cancel()
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("keep rollback error", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		rollbackErr := errors.New("rollback")
+		mock.ExpectBegin()
+		mock.ExpectRollback().WillReturnError(rollbackErr)
+
+		err = dbutils.Transaction(context.Background(), mock, func(_ pgx.Tx) error {
+			return expErr
+		})
+		assert.ErrorIs(t, err, expErr)
+		assert.ErrorIs(t, err, rollbackErr)
+		assert.Equal(t, "transaction rollback: test\nfailed to roll back transaction: rollback", err.Error())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestTransactionResult(t *testing.T) {
+	t.Run("return result", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT count").WillReturnRows(mock.NewRows([]string{"count"}).AddRow(int64(3)))
+		mock.ExpectCommit()
+
+		counter, err := dbutils.TransactionResult(context.Background(), mock, func(tx pgx.Tx) (int64, error) {
+			var counter int64
+			err := tx.QueryRow(context.Background(), "SELECT count(*) FROM test").Scan(&counter)
+			return counter, err
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), counter)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("zero value on rollback", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectCommit().WillReturnError(errors.New("test"))
+
+		result, err := dbutils.TransactionResult(context.Background(), mock, func(_ pgx.Tx) (*string, error) {
+			result := "test"
+			return &result, nil
+		})
+		assert.Error(t, err)
+		assert.Nil(t, result)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("result of last attempt", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		attempts := 0
+		result, err := dbutils.TransactionResult(context.Background(), mock, func(_ pgx.Tx) (int, error) {
+			attempts++
+			if attempts == 1 {
+				return attempts, &pgconn.PgError{Code: "40001"}
+			}
+			return attempts, nil
+		}, dbutils.WithRetry(2, dbutils.WithBackoff(time.Millisecond, time.Millisecond)))
+		require.NoError(t, err)
+		assert.Equal(t, 2, result)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -196,7 +196,7 @@ func TestPGXTransaction(t *testing.T) {
 				return nil
 			},
 			dbutils.WithAdvisoryLock("test1"),
-			dbutils.WithLockTimeout(1),
+			dbutils.WithLockTimeout(time.Second),
 		); err != nil {
 			assert.Equal(t, dbutils.ErrCouldNotAcquireLock, err)
 		} else {
@@ -205,6 +205,111 @@ func TestPGXTransaction(t *testing.T) {
 		testWg.Wait()
 	})
 
+	t.Run("try advisory lock", func(t *testing.T) {
+		var transactionWg sync.WaitGroup
+		testWg.Add(1)
+		transactionWg.Add(1)
+		release := make(chan struct{})
+		go func() {
+			if err := dbutils.Transaction(
+				ctx,
+				pgxPool,
+				func(_ pgx.Tx) error {
+					transactionWg.Done()
+					<-release
+					return nil
+				},
+				dbutils.WithAdvisoryLock("test1"),
+			); err != nil {
+				t.Error(err)
+			}
+			testWg.Done()
+		}()
+		transactionWg.Wait()
+		start := time.Now()
+		err := dbutils.Transaction(
+			ctx,
+			pgxPool,
+			func(_ pgx.Tx) error {
+				return nil
+			},
+			dbutils.WithTryAdvisoryLock("test1"),
+		)
+		assert.Equal(t, dbutils.ErrCouldNotAcquireLock, err)
+		assert.Less(t, time.Since(start), time.Second)
+		close(release)
+		testWg.Wait()
+	})
+
+	t.Run("shared advisory lock", func(t *testing.T) {
+		var readerWg sync.WaitGroup
+		release := make(chan struct{})
+		for range 2 {
+			testWg.Add(1)
+			readerWg.Add(1)
+			go func() {
+				defer testWg.Done()
+				if err := dbutils.Transaction(
+					ctx,
+					pgxPool,
+					func(_ pgx.Tx) error {
+						readerWg.Done()
+						<-release
+						return nil
+					},
+					dbutils.WithSharedAdvisoryLock("test1"),
+				); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		// Both readers hold the shared lock at the same time, neither returns before release is closed.
+		readerWg.Wait()
+
+		err := dbutils.Transaction(
+			ctx,
+			pgxPool,
+			func(_ pgx.Tx) error {
+				return nil
+			},
+			dbutils.WithAdvisoryLock("test1"),
+			dbutils.WithLockTimeout(time.Second),
+		)
+		assert.Equal(t, dbutils.ErrCouldNotAcquireLock, err)
+		close(release)
+		testWg.Wait()
+	})
+
+	t.Run("lock order", func(t *testing.T) {
+		// Transactions locking the same keys in a different order must not deadlock.
+		for i := range insertCount {
+			testWg.Add(1)
+			go func() {
+				defer testWg.Done()
+				options := []func(*dbutils.Options){
+					dbutils.WithAdvisoryLock("a"), dbutils.WithAdvisoryLock("b"),
+				}
+				if i%2 == 0 {
+					options = []func(*dbutils.Options){
+						dbutils.WithAdvisoryLock("b"), dbutils.WithAdvisoryLock("a"), dbutils.WithBatchedLocks(),
+					}
+				}
+				if err := dbutils.Transaction(
+					ctx,
+					pgxPool,
+					func(tx pgx.Tx) error {
+						_, err := tx.Exec(ctx, "SELECT pg_sleep(0.01)")
+						return err
+					},
+					options...,
+				); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		testWg.Wait()
+	})
+
 	t.Run("rollback", func(t *testing.T) {
 		expErr := errors.New("test")
 
@@ -224,4 +329,84 @@ func TestPGXTransaction(t *testing.T) {
 		assert.ErrorIs(t, err, expErr)
 		assert.Equal(t, "transaction rollback: test", err.Error())
 	})
+
+	t.Run("pool", func(t *testing.T) {
+		require.NoError(t, dbutils.Transaction(
+			ctx,
+			pgxPool,
+			func(tx pgx.Tx) error {
+				smt := "INSERT INTO test (A, B) VALUES ($1, $2);"
+				if _, err := tx.Exec(ctx, smt, "pool", 1); err != nil {
+					return err
+				}
+				return nil
+			},
+			dbutils.WithAdvisoryLock("test1"),
+		))
+
+		var counter int64
+		if err := pgxPool.QueryRow(ctx, "SELECT count(*) FROM test WHERE A = $1", "pool").Scan(&counter); err != nil {
+			t.Error(err)
+		}
+		assert.Equal(t, int64(1), counter)
+	})
+
+	t.Run("savepoint", func(t *testing.T) {
+		expErr := errors.New("test")
+
+		require.NoError(t, dbutils.Transaction(
+			ctx,
+			pgxPool,
+			func(tx pgx.Tx) error {
+				smt := "INSERT INTO test (A, B) VALUES ($1, $2);"
+				if _, err := tx.Exec(ctx, smt, "savepoint", 1); err != nil {
+					return err
+				}
+				// The inner transaction is rolled back to its savepoint, the outer one stays intact.
+				err := dbutils.Transaction(ctx, tx, func(tx pgx.Tx) error {
+					if _, err := tx.Exec(ctx, smt, "savepoint", 2); err != nil {
+						return err
+					}
+					return expErr
+				})
+				assert.ErrorIs(t, err, expErr)
+				return dbutils.Transaction(ctx, tx, func(tx pgx.Tx) error {
+					_, err := tx.Exec(ctx, smt, "savepoint", 3)
+					return err
+				}, dbutils.WithAdvisoryLock("test1"))
+			},
+			dbutils.WithAdvisoryLock("test1"),
+		))
+
+		rows, err := pgxPool.Query(ctx, "SELECT B FROM test WHERE A = $1 ORDER BY B", "savepoint")
+		require.NoError(t, err)
+		values, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+		require.NoError(t, err)
+		assert.Equal(t, []int64{1, 3}, values)
+	})
+
+	t.Run("serializable read only deferrable", func(t *testing.T) {
+		var counter int64
+		require.NoError(t, dbutils.Transaction(
+			ctx,
+			pgxPool,
+			func(tx pgx.Tx) error {
+				return tx.QueryRow(ctx, "SELECT count(*) FROM test").Scan(&counter)
+			},
+			dbutils.WithIsolation(pgx.Serializable),
+			dbutils.WithReadOnly(),
+			dbutils.WithDeferrable(),
+		))
+
+		err := dbutils.Transaction(
+			ctx,
+			pgxPool,
+			func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, "INSERT INTO test (A, B) VALUES ($1, $2);", "read only", 1)
+				return err
+			},
+			dbutils.WithReadOnly(),
+		)
+		assert.Error(t, err)
+	})
 }
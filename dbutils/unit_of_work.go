@@ -0,0 +1,94 @@
+package dbutils
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Propagation defines how a Transaction behaves if its context carries an active transaction already.
+type Propagation int
+
+const (
+	// PropagationJoin runs do in the active transaction. Only its advisory locks are applied, they are held until the
+	// active transaction ends. Timeouts would apply to the whole active transaction, so they are rejected with an
+	// OptionsError.
+	PropagationJoin Propagation = iota
+	// PropagationSavepoint runs do in a savepoint of the active transaction.
+	PropagationSavepoint
+)
+
+// txContextKey is the context key of the active transaction.
+type txContextKey struct{}
+
+// DBTX is implemented by *pgx.Conn, *pgxpool.Pool and pgx.Tx.
+type DBTX interface {
+	Beginner
+	PGXInterface
+	PGXRowInterface
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+// WithPropagation this option configures how the transaction behaves if its context carries an active transaction,
+// see TransactionContext. Default is PropagationJoin.
+func WithPropagation(propagation Propagation) func(*Options) {
+	return func(t *Options) {
+		t.propagation = propagation
+	}
+}
+
+// TransactionContext behaves like Transaction, but passes a context to do that carries the transaction. Repositories
+// get it with Querier, so the transaction does not have to be passed through all layers.
+// If ctx carries an active transaction already, do joins it or runs in a savepoint of it, see WithPropagation.
+func TransactionContext(
+	ctx context.Context,
+	db Beginner,
+	do func(ctx context.Context) error,
+	options ...func(*Options),
+) error {
+	return runTransaction(ctx, db, func(ctx context.Context, _ pgx.Tx) error {
+		return do(ctx)
+	}, options)
+}
+
+// ContextWithTx returns a copy of ctx that carries tx as the active transaction, e.g. to call repositories that use
+// Querier inside a Transaction closure. If tx was not passed by Transaction, its savepoints do not support hooks.
+func ContextWithTx(ctx context.Context, tx pgx.Tx) context.Context {
+	h, ok := tx.(*hookTx)
+	if !ok {
+		h = &hookTx{Tx: tx, detached: true}
+	}
+	return context.WithValue(ctx, txContextKey{}, h)
+}
+
+// Querier returns the transaction that is active in ctx, or db if there is none.
+// Only TransactionContext and ContextWithTx put the transaction into the context. Inside the do function of
+// Transaction, Querier returns db, unless the context is derived with ContextWithTx(ctx, tx).
+func Querier(ctx context.Context, db DBTX) DBTX {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return db
+}
+
+// TxFromContext returns the transaction that is active in ctx.
+func TxFromContext(ctx context.Context) (pgx.Tx, bool) {
+	if tx, ok := ctx.Value(txContextKey{}).(*hookTx); ok {
+		return tx, true
+	}
+	return nil, false
+}
+
+// join runs do in the active transaction tx. Errors do not roll back tx, that is up to its owner. validate rejects
+// the options that would change tx for its owner as well.
+func join(ctx context.Context, tx *hookTx, do func(ctx context.Context, tx pgx.Tx) error, opts *Options) error {
+	if err := opts.validate(tx); err != nil {
+		return err
+	}
+	if err := prepare(ctx, tx, opts); err != nil {
+		return err
+	}
+	return do(ctx, tx)
+}
@@ -0,0 +1,165 @@
+package dbutils_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/4ND3R50N/go-tools/dbutils"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionContext(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("querier", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		assert.Equal(t, mock, dbutils.Querier(ctx, mock))
+		_, ok := dbutils.TxFromContext(ctx)
+		assert.False(t, ok)
+		require.NoError(t, dbutils.TransactionContext(ctx, mock, func(ctx context.Context) error {
+			tx, ok := dbutils.TxFromContext(ctx)
+			require.True(t, ok)
+			assert.Equal(t, tx, dbutils.Querier(ctx, mock))
+			return nil
+		}))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("context with transaction", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO test").WithArgs("test", 1).WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, dbutils.Transaction(ctx, mock, func(tx pgx.Tx) error {
+			// Transaction does not put the transaction into ctx.
+			assert.Equal(t, mock, dbutils.Querier(ctx, mock))
+			ctx := dbutils.ContextWithTx(ctx, tx)
+			assert.Equal(t, tx, dbutils.Querier(ctx, mock))
+			_, err := dbutils.Querier(ctx, mock).Exec(ctx, "INSERT INTO test (A, B) VALUES ($1, $2);", "test", 1)
+			return err
+		}))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("context with foreign transaction", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		tx, err := mock.Begin(ctx)
+		require.NoError(t, err)
+		txCtx := dbutils.ContextWithTx(ctx, tx)
+		active, ok := dbutils.TxFromContext(txCtx)
+		require.True(t, ok)
+		require.NoError(t, dbutils.TransactionContext(txCtx, mock, func(ctx context.Context) error {
+			joined, _ := dbutils.TxFromContext(ctx)
+			assert.Equal(t, active, joined)
+			assert.Equal(t, dbutils.ErrHooksNotSupported, dbutils.OnCommit(joined, func(context.Context) error {
+				return nil
+			}))
+			return nil
+		}))
+		require.NoError(t, tx.Rollback(ctx))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("join active transaction", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.
+			ExpectExec("SELECT pg_advisory_xact_lock(?)").
+			WithArgs(int64(-4578387130389545126)).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		mock.ExpectExec("INSERT INTO test").WithArgs("test", 1).WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectCommit()
+
+		var committed bool
+		require.NoError(t, dbutils.TransactionContext(ctx, mock, func(ctx context.Context) error {
+			outer, _ := dbutils.TxFromContext(ctx)
+			return dbutils.Transaction(ctx, mock, func(tx pgx.Tx) error {
+				assert.Equal(t, outer, tx)
+				smt := "INSERT INTO test (A, B) VALUES ($1, $2);"
+				if _, err := dbutils.Querier(ctx, mock).Exec(ctx, smt, "test", 1); err != nil {
+					return err
+				}
+				return dbutils.OnCommit(tx, func(context.Context) error {
+					committed = true
+					return nil
+				})
+			}, dbutils.WithAdvisoryLock("test1"))
+		}))
+		assert.True(t, committed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("savepoint in active transaction", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+		mock.ExpectCommit()
+
+		require.NoError(t, dbutils.TransactionContext(ctx, mock, func(ctx context.Context) error {
+			err := dbutils.TransactionContext(ctx, mock, func(context.Context) error {
+				return assert.AnError
+			}, dbutils.WithPropagation(dbutils.PropagationSavepoint))
+			assert.ErrorIs(t, err, assert.AnError)
+			return nil
+		}))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("options of active transaction can not be changed", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mock.Close()
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		require.NoError(t, dbutils.TransactionContext(ctx, mock, func(ctx context.Context) error {
+			err := dbutils.TransactionContext(ctx, mock, func(context.Context) error {
+				return nil
+			}, dbutils.WithIsolation(pgx.Serializable))
+			var optionsErr *dbutils.OptionsError
+			assert.ErrorAs(t, err, &optionsErr)
+			// The timeouts of the active transaction are not changed by a joined call.
+			err = dbutils.TransactionContext(ctx, mock, func(context.Context) error {
+				return nil
+			}, dbutils.WithLockTimeout(time.Second), dbutils.WithAdvisoryLock("test1"))
+			require.ErrorAs(t, err, &optionsErr)
+			assert.Equal(t, "timeout", optionsErr.Option)
+			return nil
+		}))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}